@@ -0,0 +1,188 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/protoutil"
+)
+
+// Tx describes a transaction to be placed into a test block
+type Tx struct {
+	TxID           string
+	ChannelID      string
+	Type           common.HeaderType
+	Timestamp      time.Time
+	MSPID          string
+	Chaincode      string
+	Args           [][]byte
+	RWSet          *rwsetutil.TxRwSet
+	Data           []byte // payload data for non endorser transactions
+	ValidationCode peer.TxValidationCode
+	Malformed      bool // the envelope carries a payload that does not decode, e.g. a BAD_PAYLOAD transaction
+}
+
+// NewEnvelope builds an unsigned transaction envelope from the description
+func NewEnvelope(tx *Tx) (*common.Envelope, error) {
+	if tx.Malformed {
+		// a length delimited field 1 cut short
+		return &common.Envelope{Payload: []byte{0x0a, 0xff}, Signature: []byte("signature")}, nil
+	}
+	ts, err := ptypes.TimestampProto(tx.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	chdr := &common.ChannelHeader{
+		Type:      int32(tx.Type),
+		ChannelId: tx.ChannelID,
+		TxId:      tx.TxID,
+		Timestamp: ts,
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: tx.MSPID, IdBytes: []byte("cert of " + tx.MSPID)})
+	if err != nil {
+		return nil, err
+	}
+	shdr := &common.SignatureHeader{Creator: creator, Nonce: []byte("nonce")}
+	hdr := &common.Header{
+		ChannelHeader:   protoutil.MarshalOrPanic(chdr),
+		SignatureHeader: protoutil.MarshalOrPanic(shdr),
+	}
+
+	data := tx.Data
+	if tx.Type == common.HeaderType_ENDORSER_TRANSACTION {
+		if data, err = endorserTxData(tx, hdr.SignatureHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	payload := protoutil.MarshalOrPanic(&common.Payload{Header: hdr, Data: data})
+	return &common.Envelope{Payload: payload, Signature: []byte("signature")}, nil
+}
+
+func endorserTxData(tx *Tx, signatureHeader []byte) ([]byte, error) {
+	var results []byte
+	if tx.RWSet != nil {
+		var err error
+		if results, err = tx.RWSet.ToProtoBytes(); err != nil {
+			return nil, err
+		}
+	}
+	ccid := &peer.ChaincodeID{Name: tx.Chaincode}
+	ca := &peer.ChaincodeAction{Results: results, ChaincodeId: ccid}
+	prp := &peer.ProposalResponsePayload{
+		ProposalHash: []byte("proposal hash"),
+		Extension:    protoutil.MarshalOrPanic(ca),
+	}
+	cis := &peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{
+			ChaincodeId: ccid,
+			Input:       &peer.ChaincodeInput{Args: tx.Args},
+		},
+	}
+	cpp := &peer.ChaincodeProposalPayload{Input: protoutil.MarshalOrPanic(cis)}
+	cap := &peer.ChaincodeActionPayload{
+		ChaincodeProposalPayload: protoutil.MarshalOrPanic(cpp),
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: protoutil.MarshalOrPanic(prp),
+			Endorsements: []*peer.Endorsement{
+				{Endorser: []byte("endorser of " + tx.MSPID), Signature: []byte("signature")},
+			},
+		},
+	}
+	transaction := &peer.Transaction{
+		Actions: []*peer.TransactionAction{
+			{Header: signatureHeader, Payload: protoutil.MarshalOrPanic(cap)},
+		},
+	}
+	return proto.Marshal(transaction)
+}
+
+// NewBlock builds a block holding the transactions. The TRANSACTIONS_FILTER
+// is filled from the validation codes unless filtered is false, as on an orderer.
+func NewBlock(num uint64, previousHash []byte, filtered bool, txs ...*Tx) (*common.Block, error) {
+	block := protoutil.NewBlock(num, previousHash)
+	filter := make([]byte, len(txs))
+	for i, tx := range txs {
+		env, err := NewEnvelope(tx)
+		if err != nil {
+			return nil, err
+		}
+		envBytes, err := proto.Marshal(env)
+		if err != nil {
+			return nil, err
+		}
+		block.Data.Data = append(block.Data.Data, envBytes)
+		filter[i] = byte(tx.ValidationCode)
+	}
+	block.Header.DataHash = protoutil.BlockDataHash(block.Data)
+	if filtered {
+		block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = filter
+	}
+	return block, nil
+}
+
+// NewChain builds consecutive blocks, one per element of txsPerBlock, linked by their header hashes.
+// Like an orderer, it records the number of the last config block in the SIGNATURES metadata.
+func NewChain(filtered bool, txsPerBlock ...[]*Tx) ([]*common.Block, error) {
+	var blocks []*common.Block
+	var previousHash []byte
+	var lastConfig uint64
+	for i, txs := range txsPerBlock {
+		b, err := NewBlock(uint64(i), previousHash, filtered, txs...)
+		if err != nil {
+			return nil, err
+		}
+		if len(txs) == 1 && txs[0].Type == common.HeaderType_CONFIG {
+			lastConfig = uint64(i)
+		}
+		b.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = protoutil.MarshalOrPanic(&common.Metadata{
+			Value: protoutil.MarshalOrPanic(&common.OrdererBlockMetadata{LastConfig: &common.LastConfig{Index: lastConfig}}),
+		})
+		previousHash = protoutil.BlockHeaderHash(b.Header)
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// SerializeBlock encodes a block the way the fabric blockfile manager stores it
+func SerializeBlock(block *common.Block) []byte {
+	b, _ := serializeBlock(block)
+	return b
+}
+
+// serializeBlock also returns the [offset, end) range of every transaction within the block bytes
+func serializeBlock(block *common.Block) ([]byte, [][2]int) {
+	buf := proto.NewBuffer(nil)
+	buf.EncodeVarint(block.Header.Number)
+	buf.EncodeRawBytes(block.Header.DataHash)
+	buf.EncodeRawBytes(block.Header.PreviousHash)
+	buf.EncodeVarint(uint64(len(block.Data.Data)))
+	var txOffsets [][2]int
+	for _, d := range block.Data.Data {
+		start := len(buf.Bytes())
+		buf.EncodeRawBytes(d)
+		txOffsets = append(txOffsets, [2]int{start, len(buf.Bytes())})
+	}
+	buf.EncodeVarint(uint64(len(block.Metadata.Metadata)))
+	for _, m := range block.Metadata.Metadata {
+		buf.EncodeRawBytes(m)
+	}
+	return buf.Bytes(), txOffsets
+}
+
+// WriteBlockFile writes the blocks into a single blockfile, each prefixed by its length
+func WriteBlockFile(path string, blocks ...*common.Block) error {
+	var content []byte
+	for _, b := range blocks {
+		blockBytes := SerializeBlock(b)
+		content = append(content, proto.EncodeVarint(uint64(len(blockBytes)))...)
+		content = append(content, blockBytes...)
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
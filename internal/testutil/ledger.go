@@ -0,0 +1,104 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/common/ledger/blkstorage/fsblkstorage/msgs"
+	"github.com/hyperledger/fabric/common/ledger/util"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Key returns the leveldb key of a key in the logical db of a channel
+func Key(channel string, key []byte) []byte {
+	return append(append([]byte(channel), 0x00), key...)
+}
+
+func flp(fileSuffixNum, offset, bytesLength int) []byte {
+	buf := proto.NewBuffer(nil)
+	buf.EncodeVarint(uint64(fileSuffixNum))
+	buf.EncodeVarint(uint64(offset))
+	buf.EncodeVarint(uint64(bytesLength))
+	return buf.Bytes()
+}
+
+// WriteLedger writes the blocks of a channel into blockfile_000000 below chainsDir and
+// indexes them in the leveldb at indexDir the way the fabric blockfile manager does.
+// Orderers only index block numbers, which is what indexTxs=false produces.
+func WriteLedger(chainsDir, indexDir, channel string, indexTxs bool, blocks ...*common.Block) error {
+	chainDir := filepath.Join(chainsDir, channel)
+	if err := os.MkdirAll(chainDir, 0755); err != nil {
+		return err
+	}
+	db, err := leveldb.OpenFile(indexDir, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	batch := &leveldb.Batch{}
+	batch.Put(Key("_", []byte("f")), []byte("2.0"))
+
+	var content []byte
+	for _, b := range blocks {
+		blockBytes, txOffsets := serializeBlock(b)
+		lenBytes := proto.EncodeVarint(uint64(len(blockBytes)))
+		offset := len(content)
+		content = append(content, lenBytes...)
+		content = append(content, blockBytes...)
+
+		num := b.Header.Number
+		blkFlp := flp(0, offset, len(lenBytes)+len(blockBytes))
+		batch.Put(Key(channel, append([]byte{'n'}, util.EncodeOrderPreservingVarUint64(num)...)), blkFlp)
+		if !indexTxs {
+			continue
+		}
+		batch.Put(Key(channel, append([]byte{'h'}, protoutil.BlockHeaderHash(b.Header)...)), blkFlp)
+
+		for txNum, txOffset := range txOffsets {
+			txFlp := flp(0, offset+len(lenBytes)+txOffset[0], txOffset[1]-txOffset[0])
+			blkTxNum := append(util.EncodeOrderPreservingVarUint64(num), util.EncodeOrderPreservingVarUint64(uint64(txNum))...)
+			batch.Put(Key(channel, append([]byte{'a'}, blkTxNum...)), txFlp)
+
+			env, err := protoutil.GetEnvelopeFromBlock(b.Data.Data[txNum])
+			if err != nil {
+				return err
+			}
+			chdr, err := protoutil.ChannelHeader(env)
+			if err != nil {
+				// like the peer, a malformed transaction is indexed by its position only
+				continue
+			}
+			var code int32
+			if filter := b.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]; txNum < len(filter) {
+				code = int32(filter[txNum])
+			}
+			val, err := proto.Marshal(&msgs.TxIDIndexValProto{BlkLocation: blkFlp, TxLocation: txFlp, TxValidationCode: code})
+			if err != nil {
+				return err
+			}
+			txIDKey := append([]byte{'t'}, util.EncodeOrderPreservingVarUint64(uint64(len(chdr.TxId)))...)
+			txIDKey = append(append(txIDKey, chdr.TxId...), blkTxNum...)
+			batch.Put(Key(channel, txIDKey), val)
+		}
+	}
+
+	if len(blocks) != 0 {
+		last := blocks[len(blocks)-1].Header.Number
+		batch.Put(Key(channel, []byte("indexCheckpointKey")), proto.EncodeVarint(last))
+		info := proto.NewBuffer(nil)
+		info.EncodeVarint(0)
+		info.EncodeVarint(uint64(len(content)))
+		info.EncodeVarint(last)
+		info.EncodeVarint(0)
+		batch.Put(Key(channel, []byte("blkMgrInfo")), info.Bytes())
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(chainDir, "blockfile_000000"), content, 0644)
+}
@@ -93,6 +93,33 @@ func DecodeValue(encodedValue []byte) (*statedb.VersionedValue, error) {
 	return &statedb.VersionedValue{Version: ver, Value: val, Metadata: metadata}, nil
 }
 
+// EncodeValue encodes a versioned value the way the 2.x statedb stores it
+func EncodeValue(v *statedb.VersionedValue) ([]byte, error) {
+	return proto.Marshal(&msgs.VersionedValueProto{
+		VersionBytes: v.Version.ToBytes(),
+		Value:        v.Value,
+		Metadata:     v.Metadata,
+	})
+}
+
+// DecodeValueV14 decodes the statedb value bytes written by a 1.x peer.
+// From v1.3 the value is a nil byte followed by VersionedValueProto, before that
+// the version bytes were directly followed by the value.
+func DecodeValueV14(encodedValue []byte) (*statedb.VersionedValue, error) {
+	if len(encodedValue) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	// the second condition covers an old format value persisted at height <0, 0> which starts with a nil byte
+	if encodedValue[0] != byte(0) || (len(encodedValue) > 1 && encodedValue[0]|encodedValue[1] == byte(0)) {
+		ver, n, err := version.NewHeightFromBytes(encodedValue)
+		if err != nil {
+			return nil, err
+		}
+		return &statedb.VersionedValue{Version: ver, Value: encodedValue[n:]}, nil
+	}
+	return DecodeValue(encodedValue[1:])
+}
+
 // Serialize serializes metadata entries for storing in statedb
 func Serialize(metadataEntries []*kvrwset.KVMetadataEntry) ([]byte, error) {
 	metadata := &kvrwset.KVMetadataWrite{Entries: metadataEntries}
@@ -2,16 +2,17 @@ package block
 
 import (
 	"bytes"
-	"fmt"
-	"io/ioutil"
-	"reflect"
+	"encoding/json"
 	"testing"
+	"time"
 
-	"github.com/gogo/protobuf/proto"
-	goproto "github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric-config/protolator"
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/protoutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/the-medium/ledger-parser/internal/testutil"
 )
 
 func Test_Block(t *testing.T) {
@@ -19,29 +20,63 @@ func Test_Block(t *testing.T) {
 	blocks, err := GetBlocksFromBlockFile(fileName)
 	assert.NoError(t, err)
 	for _, block := range blocks {
-		var cBlock *common.Block
-		if block.IsConfig() {
-			cBlock = block.(*ConfigBlock).Block
-		} else {
-			cBlock = block.(*StandardBlock).Block
-		}
-		b, err := goproto.Marshal(cBlock)
+		cBlock := block.GetBlock()
+		b, err := proto.Marshal(cBlock)
 		assert.NoError(t, err)
 
-		msgType := goproto.MessageType("common.Block")
-		assert.NotNil(t, msgType)
+		buf := new(bytes.Buffer)
+		err = ExportJSON(buf, cBlock)
+		assert.NoError(t, err)
 
-		msg := reflect.New(msgType.Elem()).Interface().(proto.Message)
-		err = proto.Unmarshal(b, msg)
+		imported, err := ImportJSON(buf)
+		assert.NoError(t, err)
+		importedBytes, err := proto.Marshal(imported)
 		assert.NoError(t, err)
+		assert.Equal(t, b, importedBytes, "block %d", cBlock.GetHeader().Number)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	config := protoutil.MarshalOrPanic(&common.ConfigEnvelope{
+		Config: &common.Config{
+			Sequence: 1,
+			ChannelGroup: &common.ConfigGroup{
+				Values: map[string]*common.ConfigValue{
+					"HashingAlgorithm": {ModPolicy: "Admins", Value: protoutil.MarshalOrPanic(&common.HashingAlgorithm{Name: "SHA256"})},
+				},
+			},
+		},
+	})
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{{TxID: "config", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts, MSPID: "OrdererMSP", Data: config}},
+		[]*testutil.Tx{{
+			TxID: "tx1", ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts,
+			MSPID: "Org1MSP", Chaincode: "mycc", Args: [][]byte{[]byte("put"), []byte("a")},
+			RWSet: &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{
+				{NameSpace: "mycc", KvRwSet: &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "a", Value: []byte("1")}}}},
+			}},
+		}},
+	)
+	assert.NoError(t, err)
 
+	for _, b := range blocks {
 		buf := new(bytes.Buffer)
-		err = protolator.DeepMarshalJSON(buf, msg)
+		assert.NoError(t, ExportJSON(buf, b))
+		exported := buf.String()
+
+		imported, err := ImportJSON(buf)
 		assert.NoError(t, err)
+		assert.Equal(t, protoutil.MarshalOrPanic(b), protoutil.MarshalOrPanic(imported))
 
-		filename := fmt.Sprintf("block%d.json", cBlock.GetHeader().Number)
-		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
-			fmt.Printf("ERROR: Cannot write block to file:[%s], error=[%v]\n", filename, err)
+		var tree map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(exported), &tree))
+		if b.Header.Number == 0 {
+			assert.Contains(t, exported, `"name": "SHA256"`)
+		} else {
+			// the rwset and the write are expanded rather than base64 encoded
+			assert.Contains(t, exported, `"namespace": "mycc"`)
+			assert.Contains(t, exported, `"key": "a"`)
 		}
 	}
 }
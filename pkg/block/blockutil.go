@@ -15,6 +15,27 @@ func IsConfigBlock(block *common.Block) bool {
 	return protoutil.IsConfigBlock(block)
 }
 
+// GetConfigEnvelope returns the ConfigEnvelope of a config block
+// Block.BlockData.Data[0] - Envelope.Payload - Payload.Data - ConfigEnvelope
+func GetConfigEnvelope(block *common.Block) (*common.ConfigEnvelope, error) {
+	if !protoutil.IsConfigBlock(block) {
+		return nil, errors.Errorf("block [%d] is not a config block", block.GetHeader().GetNumber())
+	}
+	env, err := protoutil.ExtractEnvelope(block, 0)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := protoutil.UnmarshalPayload(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	configEnv := &common.ConfigEnvelope{}
+	if err := goproto.Unmarshal(payload.Data, configEnv); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode the config envelope of block [%d]", block.GetHeader().GetNumber())
+	}
+	return configEnv, nil
+}
+
 // GetTransactionEnvelopes returns []Envelop
 // Block.BlockData.[]Data - []Envelope
 func GetTransactionEnvelopes(block *common.Block) ([]*common.Envelope, error) {
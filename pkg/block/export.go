@@ -0,0 +1,25 @@
+package block
+
+import (
+	"io"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/common/tools/protolator"
+)
+
+// ExportJSON writes the block as the deep JSON configtxlator produces: nested payloads,
+// transactions, proposal responses, rwsets and configs are expanded instead of being
+// written as base64.
+func ExportJSON(w io.Writer, b *common.Block) error {
+	return protolator.DeepMarshalJSON(w, b)
+}
+
+// ImportJSON decodes a block written by ExportJSON (or configtxlator), re-marshaling
+// the expanded messages into their binary form
+func ImportJSON(r io.Reader) (*common.Block, error) {
+	b := &common.Block{}
+	if err := protolator.DeepUnmarshalJSON(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
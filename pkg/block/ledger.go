@@ -0,0 +1,88 @@
+package block
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	PeerLedger = iota
+	OrdererLedger
+)
+
+// Ledger locates the blockfiles and the block index of a peer or an orderer.
+//
+// peer:    <production>/ledgersData/chains/chains/<channel>, <production>/ledgersData/chains/index
+// orderer: <production>/orderer/chains/<channel>,           <production>/orderer/index
+type Ledger struct {
+	Kind      int
+	ChainsDir string
+	IndexDir  string
+}
+
+// OpenLedger detects the ledger layout below a production directory.
+// The directory may be the production root (/var/hyperledger/production) or
+// the ledgersData / orderer directory itself.
+func OpenLedger(productionDir string) (*Ledger, error) {
+	candidates := []*Ledger{
+		{PeerLedger, filepath.Join(productionDir, "ledgersData", "chains", "chains"), filepath.Join(productionDir, "ledgersData", "chains", "index")},
+		{PeerLedger, filepath.Join(productionDir, "chains", "chains"), filepath.Join(productionDir, "chains", "index")},
+		{OrdererLedger, filepath.Join(productionDir, "orderer", "chains"), filepath.Join(productionDir, "orderer", "index")},
+		{OrdererLedger, filepath.Join(productionDir, "chains"), filepath.Join(productionDir, "index")},
+	}
+	for _, l := range candidates {
+		if isDir(l.ChainsDir) && isDir(l.IndexDir) {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("error: no peer or orderer ledger found in [%s]", productionDir)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// IsOrderer reports whether the ledger belongs to an orderer
+func (l *Ledger) IsOrderer() bool {
+	return l.Kind == OrdererLedger
+}
+
+// LedgersDataDir returns the ledgersData directory of a peer, which holds the state, history and
+// pvtdata dbs next to the chains, and an empty string for an orderer
+func (l *Ledger) LedgersDataDir() string {
+	if l.IsOrderer() {
+		return ""
+	}
+	// <ledgersData>/chains/chains
+	return filepath.Dir(filepath.Dir(l.ChainsDir))
+}
+
+// ChannelDir returns the directory holding the blockfiles of a channel
+func (l *Ledger) ChannelDir(channel string) string {
+	return filepath.Join(l.ChainsDir, channel)
+}
+
+// Channels returns the names of the channels stored in the ledger, including the system channel of an orderer
+func (l *Ledger) Channels() ([]string, error) {
+	entries, err := ioutil.ReadDir(l.ChainsDir)
+	if err != nil {
+		return nil, err
+	}
+	channels := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			channels = append(channels, entry.Name())
+		}
+	}
+	sort.Strings(channels)
+	return channels, nil
+}
+
+// WalkBlocks calls fn for every block of the channel, in block order
+func (l *Ledger) WalkBlocks(channel string, fn func(Block) error) error {
+	return WalkBlocks(l.ChannelDir(channel), fn)
+}
@@ -0,0 +1,67 @@
+package block
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const blockfilePrefix = "blockfile_"
+
+// BlockFiles returns the paths of the blockfiles in a channel directory
+// (e.g. .../chains/chains/mychannel), ordered by their suffix number.
+func BlockFiles(chainDir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(chainDir)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot read chain directory: [%s], error=[%v]", chainDir, err)
+	}
+
+	suffixes := []int{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), blockfilePrefix) {
+			continue
+		}
+		num, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), blockfilePrefix))
+		if err != nil {
+			continue
+		}
+		suffixes = append(suffixes, num)
+	}
+	sort.Ints(suffixes)
+
+	files := make([]string, 0, len(suffixes))
+	for _, num := range suffixes {
+		files = append(files, BlockFilePath(chainDir, num))
+	}
+	return files, nil
+}
+
+// BlockFilePath returns the path of the blockfile with the given suffix number
+func BlockFilePath(chainDir string, fileSuffixNum int) string {
+	return filepath.Join(chainDir, fmt.Sprintf("%s%06d", blockfilePrefix, fileSuffixNum))
+}
+
+// WalkBlocks calls fn for every block stored in the blockfiles of a channel directory, in block order.
+// Blockfiles are loaded one at a time, so only a single file is held in memory.
+func WalkBlocks(chainDir string, fn func(Block) error) error {
+	files, err := BlockFiles(chainDir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		blocks, err := GetBlocksFromBlockFile(f)
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
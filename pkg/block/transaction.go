@@ -0,0 +1,210 @@
+package block
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// Transaction is the decoded view of a single transaction envelope in a block.
+// Chaincode, Function and RWSet are only set for endorser transactions.
+type Transaction struct {
+	BlockNum       uint64
+	TxNum          uint64
+	TxID           string
+	ChannelID      string
+	Type           common.HeaderType
+	Timestamp      time.Time
+	CreatorMSPID   string
+	ValidationCode peer.TxValidationCode
+	Chaincode      string
+	Function       string
+	RWSet          *rwsetutil.TxRwSet
+	Size           int
+}
+
+// IsValid reports whether the committing peer marked the transaction as valid
+func (tx *Transaction) IsValid() bool {
+	return tx.ValidationCode == peer.TxValidationCode_VALID
+}
+
+// GetTransactions decodes every transaction envelope of the block.
+// When the block carries no TRANSACTIONS_FILTER the validation code is reported as NOT_VALIDATED.
+func GetTransactions(block *common.Block) ([]*Transaction, error) {
+	txs := make([]*Transaction, 0, len(block.GetData().GetData()))
+	for txNum := range block.GetData().GetData() {
+		tx, err := GetTransaction(block, txNum)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// GetTransaction decodes the transaction envelope at txNum
+func GetTransaction(block *common.Block, txNum int) (*Transaction, error) {
+	data := block.GetData().GetData()
+	if txNum < 0 || txNum >= len(data) {
+		return nil, errors.Errorf("block [%d] has no transaction [%d]", block.GetHeader().GetNumber(), txNum)
+	}
+	tx, err := decodeTransaction(data[txNum])
+	if err != nil {
+		return nil, errors.WithMessagef(err, "cannot decode transaction [%d] of block [%d]", txNum, block.GetHeader().GetNumber())
+	}
+	tx.BlockNum = block.GetHeader().GetNumber()
+	tx.TxNum = uint64(txNum)
+	tx.ValidationCode = GetValidationCode(block, txNum)
+	return tx, nil
+}
+
+// GetValidationCode returns the validation code of the transaction at txNum from the
+// TRANSACTIONS_FILTER without decoding it, NOT_VALIDATED when the block carries no filter.
+// The peer never decodes the payload of an invalid transaction, so it may not decode at all.
+func GetValidationCode(block *common.Block, txNum int) peer.TxValidationCode {
+	txfilters := txFilters(block)
+	if txNum < 0 || txNum >= len(txfilters) {
+		return peer.TxValidationCode_NOT_VALIDATED
+	}
+	return peer.TxValidationCode(txfilters[txNum])
+}
+
+// GetTransactionHeader decodes only the headers of the transaction at txNum,
+// leaving Chaincode, Function and RWSet empty.
+func GetTransactionHeader(block *common.Block, txNum int) (*Transaction, error) {
+	data := block.GetData().GetData()
+	if txNum < 0 || txNum >= len(data) {
+		return nil, errors.Errorf("block [%d] has no transaction [%d]", block.GetHeader().GetNumber(), txNum)
+	}
+	env, err := protoutil.GetEnvelopeFromBlock(data[txNum])
+	if err != nil {
+		return nil, err
+	}
+	payload, err := protoutil.UnmarshalPayload(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeHeaders(payload)
+	if err != nil {
+		return nil, err
+	}
+	tx.BlockNum = block.GetHeader().GetNumber()
+	tx.TxNum = uint64(txNum)
+	tx.Size = len(data[txNum])
+	return tx, nil
+}
+
+func txFilters(block *common.Block) []byte {
+	metadata := block.GetMetadata().GetMetadata()
+	if len(metadata) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		return nil
+	}
+	return metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+}
+
+func decodeHeaders(payload *common.Payload) (*Transaction, error) {
+	if payload.Header == nil {
+		return nil, errors.New("missing payload header")
+	}
+	chdr, err := protoutil.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+	shdr, err := protoutil.UnmarshalSignatureHeader(payload.Header.SignatureHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{
+		TxID:      chdr.TxId,
+		ChannelID: chdr.ChannelId,
+		Type:      common.HeaderType(chdr.Type),
+	}
+	if chdr.Timestamp != nil {
+		if tx.Timestamp, err = ptypes.Timestamp(chdr.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	if len(shdr.Creator) != 0 {
+		creator, err := protoutil.UnmarshalSerializedIdentity(shdr.Creator)
+		if err != nil {
+			return nil, err
+		}
+		tx.CreatorMSPID = creator.Mspid
+	}
+	return tx, nil
+}
+
+func decodeTransaction(envBytes []byte) (*Transaction, error) {
+	env, err := protoutil.GetEnvelopeFromBlock(envBytes)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := DecodeEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+	tx.Size = len(envBytes)
+	return tx, nil
+}
+
+// DecodeEnvelope decodes a single transaction envelope, e.g. one read through the block index.
+// BlockNum, TxNum, ValidationCode and Size are left for the caller to fill in.
+func DecodeEnvelope(env *common.Envelope) (*Transaction, error) {
+	payload, err := protoutil.UnmarshalPayload(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeHeaders(payload)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Type != common.HeaderType_ENDORSER_TRANSACTION {
+		return tx, nil
+	}
+
+	actions, err := GetTxEnvPayloadActions(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(actions) == 0 {
+		return tx, nil
+	}
+	// fabric only supports a single action per endorser transaction
+	caPayload, err := GetActionPayload(actions[0])
+	if err != nil {
+		return nil, err
+	}
+	if caPayload.Action == nil {
+		return nil, errors.New("missing chaincode endorsed action")
+	}
+	ca, err := GetActionProposalresponseCCAction(caPayload)
+	if err != nil {
+		return nil, err
+	}
+	if tx.RWSet, err = GetActionProposalresponseResults(ca); err != nil {
+		return nil, err
+	}
+	tx.Chaincode = ca.GetChaincodeId().GetName()
+
+	cpPayload, err := GetActionCCProposalPayload(caPayload)
+	if err != nil {
+		return nil, err
+	}
+	cis, err := GetActionCCProposalCCISpec(cpPayload)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Chaincode == "" {
+		tx.Chaincode = cis.GetChaincodeSpec().GetChaincodeId().GetName()
+	}
+	if args := cis.GetChaincodeSpec().GetInput().GetArgs(); len(args) != 0 {
+		tx.Function = string(args[0])
+	}
+	return tx, nil
+}
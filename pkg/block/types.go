@@ -14,6 +14,7 @@ type Block interface {
 	GetTransactionEnvelops() ([]*common.Envelope, error)
 	GetTxRWSets(txEnvelopes []*common.Envelope) (txRWSets []*rwsetutil.TxRwSet, err error)
 	GetTxFilters() []byte
+	GetBlock() *common.Block
 	IsConfig() bool
 }
 
@@ -30,7 +31,11 @@ func (b ConfigBlock) GetTxRWSets(txEnvelopes []*common.Envelope) (txRWSets []*rw
 }
 
 func (b ConfigBlock) GetTxFilters() []byte {
-	return b.Block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	return txFilters(b.Block)
+}
+
+func (b ConfigBlock) GetBlock() *common.Block {
+	return b.Block
 }
 
 func (b ConfigBlock) IsConfig() bool {
@@ -55,14 +60,17 @@ func (b StandardBlock) GetTransactionEnvelops() ([]*common.Envelope, error) {
 	return txs, nil
 }
 
+// GetTxRWSets returns the rwsets of the valid endorser transactions.
+// Blocks of an orderer ledger carry no TRANSACTIONS_FILTER; there every endorser transaction is returned.
 func (b StandardBlock) GetTxRWSets(txEnvelopes []*common.Envelope) (txRWSets []*rwsetutil.TxRwSet, err error) {
 	txfilters := b.GetTxFilters()
-	if len(txEnvelopes) != len(txfilters) {
+	unfiltered := len(txfilters) == 0
+	if !unfiltered && len(txEnvelopes) != len(txfilters) {
 		return nil, fmt.Errorf("The number of tx does not match the number of filters")
 	}
 
 	for idx, txEnvelope := range txEnvelopes {
-		if peer.TxValidationCode(txfilters[idx]) != peer.TxValidationCode_VALID {
+		if !unfiltered && peer.TxValidationCode(txfilters[idx]) != peer.TxValidationCode_VALID {
 			continue
 		}
 
@@ -71,6 +79,15 @@ func (b StandardBlock) GetTxRWSets(txEnvelopes []*common.Envelope) (txRWSets []*
 			return nil, err
 		}
 
+		chdr, err := GetTxEnvPayloadChannelHeader(txPayload)
+		if err != nil {
+			return nil, err
+		}
+		// e.g. ORDERER_TRANSACTION in the system channel
+		if common.HeaderType(chdr.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+			continue
+		}
+
 		tx, err := putil.UnmarshalTransaction(txPayload.Data)
 		if err != nil {
 			return nil, err
@@ -106,7 +123,11 @@ func (b StandardBlock) GetTxRWSets(txEnvelopes []*common.Envelope) (txRWSets []*
 }
 
 func (b StandardBlock) GetTxFilters() []byte {
-	return b.Block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	return txFilters(b.Block)
+}
+
+func (b StandardBlock) GetBlock() *common.Block {
+	return b.Block
 }
 
 func (b StandardBlock) IsConfig() bool {
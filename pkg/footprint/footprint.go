@@ -0,0 +1,459 @@
+package footprint
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/history"
+	"github.com/the-medium/ledger-parser/pkg/index"
+	"github.com/the-medium/ledger-parser/pkg/pvtdata"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+// kinds of stores the analyzer understands
+const (
+	State   = "stateLeveldb"
+	History = "historyLeveldb"
+	Pvtdata = "pvtdataStore"
+	Index   = "index"
+)
+
+// HashedPrefix is the key prefix of hashed private keys, whose cleartext is unknown
+const HashedPrefix = "(hashed)"
+
+// prefixSeparators end the prefix of a simple key, e.g. "asset" of "asset:1001"
+const prefixSeparators = ":/_-.|#~"
+
+var indexKinds = map[int]string{
+	index.BlockNum:                  "block number",
+	index.BlockHash:                 "block hash",
+	index.TxID:                      "transaction id",
+	index.BlockNumTxNum:             "block and transaction number",
+	index.BlkMgrInfo:                "blockfiles info",
+	index.CheckPoint:                "index checkpoint",
+	index.FormatKey:                 "format",
+	index.BlockTxID:                 "block transaction id",
+	index.TxValidationCode:          "transaction validation code",
+	index.BootstrappingSnapshotInfo: "bootstrapping snapshot info",
+}
+
+var pvtdataKinds = map[byte]string{
+	pvtdata.PendingCommitKey:                      "pending commit",
+	pvtdata.LastCommittedBlkkey:                   "last committed block",
+	pvtdata.PvtDataKeyPrefix:                      "private data",
+	pvtdata.ExpiryKeyPrefix:                       "expiry",
+	pvtdata.EligiblePrioritizedMissingDataGroup:   "eligible prioritized missing data",
+	pvtdata.IneligibleMissingDataKeyGroup:         "ineligible missing data",
+	pvtdata.CollEligibleKeyPrefix:                 "collection eligibility",
+	pvtdata.LastUpdatedOldBlocksKey:               "last updated old blocks",
+	pvtdata.EligibleDeprioritizedMissingDataGroup: "eligible deprioritized missing data",
+}
+
+// Size totals the entries of a group
+type Size struct {
+	Entries    int64 `json:"entries"`
+	KeyBytes   int64 `json:"key_bytes"`
+	ValueBytes int64 `json:"value_bytes"`
+}
+
+// Bytes returns the key and value bytes of the group
+func (s *Size) Bytes() int64 {
+	return s.KeyBytes + s.ValueBytes
+}
+
+func (s *Size) add(keyBytes, valueBytes int) {
+	s.Entries++
+	s.KeyBytes += int64(keyBytes)
+	s.ValueBytes += int64(valueBytes)
+}
+
+// NamespaceSize is the footprint of a namespace. Entries that belong to no namespace, such as
+// savepoints, index entries and pvtdataStore bookkeeping, are counted in the namespace ""
+// with their kind as prefix.
+type NamespaceSize struct {
+	Size
+	Collections map[string]*Size `json:"collections,omitempty"`
+	Prefixes    map[string]*Size `json:"prefixes"` // composite keys by object type, simple keys by the text before a separator
+}
+
+// ChannelSize is the footprint of a channel
+type ChannelSize struct {
+	Size
+	Namespaces map[string]*NamespaceSize `json:"namespaces"`
+}
+
+// Entry is a single key of the db
+type Entry struct {
+	Channel    string `json:"channel"`
+	Namespace  string `json:"namespace,omitempty"`
+	Collection string `json:"collection,omitempty"`
+	Key        string `json:"key"` // hex encoded unless printable
+	KeyBytes   int    `json:"key_bytes"`
+	ValueBytes int    `json:"value_bytes"`
+}
+
+// Report is the storage footprint of a db
+type Report struct {
+	Store     string                  `json:"store"`
+	Total     Size                    `json:"total"`
+	Channels  map[string]*ChannelSize `json:"channels"`
+	TopKeys   []Entry                 `json:"top_keys"`
+	TopValues []Entry                 `json:"top_values"`
+
+	topKeys, topValues *topEntries
+}
+
+// AnalyzeDir opens a db read-only and analyzes it, see Analyze
+func AnalyzeDir(store, path, channel string, top int) (*Report, error) {
+	opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+	db, err := leveldb.OpenFile(path, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot open %s: [%s], error=[%v]", store, path, err)
+	}
+	defer db.Close()
+	return Analyze(store, db, channel, top)
+}
+
+// Analyze totals the key and value bytes of a stateLeveldb, historyLeveldb, pvtdataStore or
+// block index per channel, namespace, collection and key prefix, and keeps the top largest keys
+// and values. All channels are analyzed if channel is empty.
+func Analyze(store string, db *leveldb.DB, channel string, top int) (*Report, error) {
+	var classify func(key, value []byte) (*Entry, string, error)
+	var f format.Version
+	switch store {
+	case State, History, Index:
+		// the pvtdataStore has no format key and keeps its layout across formats
+		var err error
+		f, err = format.Detect(db)
+		if err == format.ErrEmptyDB {
+			// nothing to classify, the report stays empty
+			f, err = format.V2_0, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch store {
+	case State:
+		classify = func(key, value []byte) (*Entry, string, error) { return classifyState(key, value, f) }
+	case History:
+		classify = func(key, value []byte) (*Entry, string, error) { return classifyHistory(key, value, f) }
+	case Pvtdata:
+		classify = func(key, value []byte) (*Entry, string, error) { return classifyPvtdata(key, value) }
+	case Index:
+		classify = func(key, value []byte) (*Entry, string, error) { return classifyIndex(key, value, f) }
+	default:
+		return nil, fmt.Errorf("unknown store [%s]", store)
+	}
+
+	r := &Report{
+		Store:     store,
+		Channels:  map[string]*ChannelSize{},
+		topKeys:   newTopEntries(top, func(e *Entry) int { return e.KeyBytes }),
+		topValues: newTopEntries(top, func(e *Entry) int { return e.ValueBytes }),
+	}
+	var slice *lutil.Range
+	if channel != "" {
+		slice = lutil.BytesPrefix(append([]byte(channel), 0x00))
+	}
+	iter := db.NewIterator(slice, nil)
+	defer iter.Release()
+	for iter.Next() {
+		e, prefix, err := classify(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		e.KeyBytes, e.ValueBytes = len(iter.Key()), len(iter.Value())
+		r.add(e, prefix)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	r.TopKeys, r.TopValues = r.topKeys.sorted(), r.topValues.sorted()
+	return r, nil
+}
+
+func (r *Report) add(e *Entry, prefix string) {
+	r.Total.add(e.KeyBytes, e.ValueBytes)
+	cs, ok := r.Channels[e.Channel]
+	if !ok {
+		cs = &ChannelSize{Namespaces: map[string]*NamespaceSize{}}
+		r.Channels[e.Channel] = cs
+	}
+	cs.add(e.KeyBytes, e.ValueBytes)
+	ns, ok := cs.Namespaces[e.Namespace]
+	if !ok {
+		ns = &NamespaceSize{Collections: map[string]*Size{}, Prefixes: map[string]*Size{}}
+		cs.Namespaces[e.Namespace] = ns
+	}
+	ns.add(e.KeyBytes, e.ValueBytes)
+	if e.Collection != "" {
+		sizeOf(ns.Collections, e.Collection).add(e.KeyBytes, e.ValueBytes)
+	}
+	sizeOf(ns.Prefixes, prefix).add(e.KeyBytes, e.ValueBytes)
+	r.topKeys.add(e)
+	r.topValues.add(e)
+}
+
+func sizeOf(sizes map[string]*Size, name string) *Size {
+	s, ok := sizes[name]
+	if !ok {
+		s = &Size{}
+		sizes[name] = s
+	}
+	return s
+}
+
+// classifyState groups a stateLeveldb entry by the namespace, collection and key prefix of its record
+func classifyState(key, value []byte, f format.Version) (*Entry, string, error) {
+	e := &Entry{Channel: channelOf(key)}
+	kv, err := state.ParseKVWithFormat(key, value, "", f)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case kv == nil:
+		e.Key = printable(key)
+		return e, "unknown", nil
+	case kv.Type() == state.FormatVersion:
+		e.Key = printable(key)
+		return e, "format", nil
+	case kv.Type() == state.SavePoint:
+		e.Key = printable(key)
+		return e, "savepoint", nil
+	}
+	record, err := kv.Decode()
+	if err != nil {
+		return nil, "", err
+	}
+	e.Namespace, e.Collection = record.Namespace, record.Collection
+	if record.Hashed {
+		e.Key = hex.EncodeToString([]byte(record.Key))
+		return e, HashedPrefix, nil
+	}
+	e.Key = printable([]byte(record.Key))
+	if record.Composite != nil {
+		e.Key = record.Composite.String()
+	}
+	return e, keyPrefix(record.Key), nil
+}
+
+// classifyHistory groups a historyLeveldb entry by the namespace and key prefix of the key it indexes
+func classifyHistory(key, value []byte, f format.Version) (*Entry, string, error) {
+	e := &Entry{Channel: channelOf(key), Key: printable(key)}
+	kv, err := history.ParseKVWithFormat(key, value, "", f)
+	if err != nil {
+		return nil, "", err
+	}
+	general, ok := kv.(*history.GeneralKV)
+	if !ok {
+		return e, kv.Describe(), nil
+	}
+	hk, err := general.Decode()
+	if err != nil {
+		return nil, "", err
+	}
+	e.Namespace, e.Key = hk.Namespace, printable([]byte(hk.Key))
+	return e, keyPrefix(hk.Key), nil
+}
+
+// classifyPvtdata groups the private data of a pvtdataStore by namespace and collection,
+// its bookkeeping entries by kind
+func classifyPvtdata(key, value []byte) (*Entry, string, error) {
+	e := &Entry{Channel: channelOf(key), Key: printable(key)}
+	internalKey := bytes.SplitN(key, []byte{0x00}, 2)
+	if len(internalKey) != 2 || len(internalKey[1]) == 0 {
+		return e, "unknown", nil
+	}
+	kind, ok := pvtdataKinds[internalKey[1][0]]
+	if !ok {
+		return e, "unknown", nil
+	}
+	if internalKey[1][0] == pvtdata.PvtDataKeyPrefix {
+		kv, err := pvtdata.ParseKV(key, value, "")
+		if err != nil {
+			return nil, "", err
+		}
+		ns, coll, err := kv.(pvtdata.PvtDataKV).Namespace()
+		if err != nil {
+			return nil, "", err
+		}
+		e.Namespace, e.Collection = ns, coll
+	}
+	return e, kind, nil
+}
+
+// classifyIndex groups block index entries by kind
+func classifyIndex(key, value []byte, f format.Version) (*Entry, string, error) {
+	e := &Entry{Channel: channelOf(key), Key: printable(key)}
+	kv, err := index.ParseKVWithFormat(key, value, "", f)
+	if err != nil || kv == nil {
+		return e, "unknown", nil
+	}
+	return e, indexKinds[kv.Type()], nil
+}
+
+func channelOf(key []byte) string {
+	return string(bytes.SplitN(key, []byte{0x00}, 2)[0])
+}
+
+// keyPrefix returns the object type of a composite key, or the text of a simple key before
+// the first separator. Keys without a separator have no prefix.
+func keyPrefix(key string) string {
+	if ck, ok := state.SplitCompositeKey(key); ok {
+		return ck.ObjectType
+	}
+	if i := strings.IndexAny(key, prefixSeparators); i > 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// printable returns the key as text, or hex encoded if it holds control characters
+func printable(key []byte) string {
+	if !utf8.Valid(key) {
+		return hex.EncodeToString(key)
+	}
+	for _, r := range string(key) {
+		if unicode.IsControl(r) {
+			return hex.EncodeToString(key)
+		}
+	}
+	return string(key)
+}
+
+// JSON returns the report encoded as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary returns a plain-text summary of the report, groups ordered by their bytes
+func (r *Report) Summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "store: %s\n", r.Store)
+	fmt.Fprintf(&sb, "total: %s\n", formatSize(&r.Total))
+
+	for _, channel := range sortedChannels(r.Channels) {
+		cs := r.Channels[channel]
+		fmt.Fprintf(&sb, "\n%s: %s\n", channel, formatSize(&cs.Size))
+		for _, name := range sortedNamespaces(cs.Namespaces) {
+			ns := cs.Namespaces[name]
+			fmt.Fprintf(&sb, "\t%-32s %s\n", displayName(name), formatSize(&ns.Size))
+			for _, coll := range sortedSizes(ns.Collections) {
+				fmt.Fprintf(&sb, "\t\tcollection %-21s %s\n", coll, formatSize(ns.Collections[coll]))
+			}
+			for _, prefix := range sortedSizes(ns.Prefixes) {
+				fmt.Fprintf(&sb, "\t\tprefix %-25s %s\n", displayName(prefix), formatSize(ns.Prefixes[prefix]))
+			}
+		}
+	}
+
+	sb.WriteString("\nlargest keys:\n")
+	writeEntries(&sb, r.TopKeys, func(e Entry) int { return e.KeyBytes })
+	sb.WriteString("\nlargest values:\n")
+	writeEntries(&sb, r.TopValues, func(e Entry) int { return e.ValueBytes })
+	return sb.String()
+}
+
+func formatSize(s *Size) string {
+	return fmt.Sprintf("entries: %10d  keys: %12d B  values: %14d B", s.Entries, s.KeyBytes, s.ValueBytes)
+}
+
+func displayName(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return name
+}
+
+func writeEntries(sb *strings.Builder, entries []Entry, size func(Entry) int) {
+	for _, e := range entries {
+		path := e.Channel + "/" + e.Namespace
+		if e.Collection != "" {
+			path += "/" + e.Collection
+		}
+		fmt.Fprintf(sb, "\t%12d B  %s  %s\n", size(e), path, e.Key)
+	}
+}
+
+func sortedChannels(m map[string]*ChannelSize) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return m[names[i]].Bytes() > m[names[j]].Bytes() })
+	return names
+}
+
+func sortedNamespaces(m map[string]*NamespaceSize) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return m[names[i]].Bytes() > m[names[j]].Bytes() })
+	return names
+}
+
+func sortedSizes(m map[string]*Size) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return m[names[i]].Bytes() > m[names[j]].Bytes() })
+	return names
+}
+
+// topEntries keeps the n largest entries in a min-heap
+type topEntries struct {
+	n       int
+	size    func(*Entry) int
+	entries []*Entry
+}
+
+func newTopEntries(n int, size func(*Entry) int) *topEntries {
+	return &topEntries{n: n, size: size}
+}
+
+func (t *topEntries) Len() int           { return len(t.entries) }
+func (t *topEntries) Less(i, j int) bool { return t.size(t.entries[i]) < t.size(t.entries[j]) }
+func (t *topEntries) Swap(i, j int)      { t.entries[i], t.entries[j] = t.entries[j], t.entries[i] }
+func (t *topEntries) Push(x interface{}) { t.entries = append(t.entries, x.(*Entry)) }
+func (t *topEntries) Pop() (x interface{}) {
+	x, t.entries = t.entries[len(t.entries)-1], t.entries[:len(t.entries)-1]
+	return x
+}
+
+func (t *topEntries) add(e *Entry) {
+	if t.n <= 0 {
+		return
+	}
+	if len(t.entries) < t.n {
+		heap.Push(t, e)
+		return
+	}
+	if t.size(e) > t.size(t.entries[0]) {
+		t.entries[0] = e
+		heap.Fix(t, 0)
+	}
+}
+
+// sorted returns the entries, largest first
+func (t *topEntries) sorted() []Entry {
+	entries := make([]Entry, 0, len(t.entries))
+	for _, e := range t.entries {
+		entries = append(entries, *e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return t.size(&entries[i]) > t.size(&entries[j]) })
+	return entries
+}
@@ -0,0 +1,117 @@
+package footprint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/ledger/util"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+func encodeValue(t *testing.T, value string) []byte {
+	b, err := utils.EncodeValue(&statedb.VersionedValue{Value: []byte(value), Version: version.NewHeight(1, 0)})
+	assert.NoError(t, err)
+	return b
+}
+
+func openDB(t *testing.T, dir, name string, entries map[string][]byte) *leveldb.DB {
+	db, err := leveldb.OpenFile(filepath.Join(dir, name), nil)
+	assert.NoError(t, err)
+	for key, value := range entries {
+		assert.NoError(t, db.Put([]byte(key), value, nil))
+	}
+	return db
+}
+
+func TestAnalyze(t *testing.T) {
+	dir, err := ioutil.TempDir("", "footprint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	asset1, err := state.CreateCompositeKey("asset", []string{"1"})
+	assert.NoError(t, err)
+	asset2, err := state.CreateCompositeKey("asset", []string{"2"})
+	assert.NoError(t, err)
+	large := strings.Repeat("x", 1000)
+	db := openDB(t, dir, State, map[string][]byte{
+		string(format.FormatKey):                          []byte("2.0"),
+		"mychannel\x00s":                                  version.NewHeight(1, 0).ToBytes(),
+		"mychannel\x00dmycc\x00" + asset1:                 encodeValue(t, large),
+		"mychannel\x00dmycc\x00" + asset2:                 encodeValue(t, "v"),
+		"mychannel\x00dmycc\x00user:1":                    encodeValue(t, "v"),
+		"mychannel\x00dmycc\x00plain":                     encodeValue(t, "v"),
+		"mychannel\x00dmycc$$hcoll1\x00\xab\xcd":          encodeValue(t, "hash"),
+		"mychannel\x00dmycc$$pcoll1\x00user:2":            encodeValue(t, "secret"),
+		"other\x00dothercc\x00" + strings.Repeat("k", 50): encodeValue(t, "v"),
+	})
+	defer db.Close()
+
+	r, err := Analyze(State, db, "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), r.Total.Entries)
+	mycc := r.Channels["mychannel"].Namespaces["mycc"]
+	assert.Equal(t, int64(6), mycc.Entries)
+	assert.Equal(t, int64(2), mycc.Prefixes["asset"].Entries)
+	assert.Equal(t, int64(2), mycc.Prefixes["user"].Entries)
+	assert.Equal(t, int64(1), mycc.Prefixes[""].Entries)
+	assert.Equal(t, int64(1), mycc.Prefixes[HashedPrefix].Entries)
+	assert.Equal(t, int64(2), mycc.Collections["coll1"].Entries)
+	assert.Equal(t, int64(1), r.Channels["mychannel"].Namespaces[""].Prefixes["savepoint"].Entries)
+	assert.Equal(t, int64(1), r.Channels["_"].Namespaces[""].Prefixes["format"].Entries)
+
+	assert.Len(t, r.TopValues, 2)
+	assert.Equal(t, "asset[1]", r.TopValues[0].Key)
+	assert.Equal(t, "mycc", r.TopValues[0].Namespace)
+	assert.Equal(t, strings.Repeat("k", 50), r.TopKeys[0].Key)
+	assert.Equal(t, "other", r.TopKeys[0].Channel)
+
+	r, err = Analyze(State, db, "other", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), r.Total.Entries)
+	assert.Contains(t, r.Summary(), "other/othercc")
+
+	pvt := openDB(t, dir, Pvtdata, map[string][]byte{
+		"mychannel\x00\x01": proto.EncodeVarint(1),
+		"mychannel\x00\x02" + string(util.EncodeOrderPreservingVarUint64(1)) + string(util.EncodeOrderPreservingVarUint64(0)) + "mycc\x00coll1": []byte("rwset"),
+	})
+	defer pvt.Close()
+	r, err = Analyze(Pvtdata, pvt, "mychannel", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), r.Channels["mychannel"].Namespaces["mycc"].Collections["coll1"].Entries)
+	assert.Equal(t, int64(1), r.Channels["mychannel"].Namespaces[""].Prefixes["last committed block"].Entries)
+
+	idx := openDB(t, dir, Index, map[string][]byte{
+		string(format.FormatKey):                                          []byte("2.0"),
+		"mychannel\x00indexCheckpointKey":                                 proto.EncodeVarint(1),
+		"mychannel\x00n" + string(util.EncodeOrderPreservingVarUint64(1)): {0x00, 0x00, 0x10},
+	})
+	defer idx.Close()
+	r, err = Analyze(Index, idx, "mychannel", 10)
+	assert.NoError(t, err)
+	prefixes := r.Channels["mychannel"].Namespaces[""].Prefixes
+	assert.Equal(t, int64(1), prefixes["index checkpoint"].Entries)
+	assert.Equal(t, int64(1), prefixes["block number"].Entries)
+
+	_, err = Analyze("unknown", idx, "", 10)
+	assert.Error(t, err)
+
+	// a store created but never written
+	empty := openDB(t, dir, "empty", map[string][]byte{})
+	defer empty.Close()
+	for _, store := range []string{State, History, Pvtdata, Index} {
+		r, err = Analyze(store, empty, "", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), r.Total.Entries)
+		assert.Empty(t, r.Channels)
+	}
+}
@@ -0,0 +1,75 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/common/ledger/dataformat"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Version is the data format of a ledger leveldb as recorded in its format key
+type Version string
+
+const (
+	// V1_4 is the format written by Fabric 1.x peers, which record no format key
+	V1_4 Version = dataformat.Version1x
+	// V2_0 is the format written by Fabric 2.0 and later peers. Fabric 2.3+ keeps
+	// the "2.0" format; its additions (e.g. the bootstrappingSnapshotInfo index entry)
+	// are handled by the 2.0 decoders.
+	V2_0 Version = dataformat.Version20
+)
+
+// FormatKey is the leveldb key holding the data format. It lives in the internal db "_".
+var FormatKey = []byte{'_', 0x00, 'f'}
+
+func (v Version) String() string {
+	if v == V1_4 {
+		return "1.x"
+	}
+	return string(v)
+}
+
+// ErrEmptyDB is returned by Detect for a db without any entry, e.g. a store created but never written
+var ErrEmptyDB = errors.New("cannot detect the format of an empty db")
+
+// Detect returns the data format of an index, state or history leveldb.
+// A non-empty db without format key was written by a Fabric 1.x peer.
+func Detect(db *leveldb.DB) (Version, error) {
+	value, err := db.Get(FormatKey, nil)
+	switch err {
+	case nil:
+	case leveldb.ErrNotFound:
+		iter := db.NewIterator(nil, nil)
+		empty := !iter.Next()
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return "", err
+		}
+		if empty {
+			return "", ErrEmptyDB
+		}
+		return V1_4, nil
+	default:
+		return "", err
+	}
+
+	switch v := Version(value); v {
+	case V2_0:
+		return v, nil
+	default:
+		return "", fmt.Errorf("unsupported data format [%s]", value)
+	}
+}
+
+// DetectFile opens the leveldb at path read-only and detects its data format
+func DetectFile(path string) (Version, error) {
+	opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+	db, err := leveldb.OpenFile(path, &opts)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	return Detect(db)
+}
@@ -0,0 +1,38 @@
+package format
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestDetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "format")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := leveldb.OpenFile(dir, nil)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = Detect(db)
+	assert.EqualError(t, err, "cannot detect the format of an empty db")
+
+	assert.NoError(t, db.Put([]byte("mychannel\x00mycc\x00key"), []byte{0x00}, nil))
+	v, err := Detect(db)
+	assert.NoError(t, err)
+	assert.Equal(t, V1_4, v)
+	assert.Equal(t, "1.x", v.String())
+
+	assert.NoError(t, db.Put(FormatKey, []byte("2.0"), nil))
+	v, err = Detect(db)
+	assert.NoError(t, err)
+	assert.Equal(t, V2_0, v)
+
+	assert.NoError(t, db.Put(FormatKey, []byte("9.9"), nil))
+	_, err = Detect(db)
+	assert.EqualError(t, err, "unsupported data format [9.9]")
+}
@@ -0,0 +1,344 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/index"
+	"github.com/the-medium/ledger-parser/pkg/pvtdata"
+)
+
+// store names used in the report
+const (
+	BlkMgrInfo = "blkMgrInfo"
+	Index      = "index"
+	State      = "stateLeveldb"
+	History    = "historyLeveldb"
+	Pvtdata    = "pvtdataStore"
+)
+
+// Stores are the stores of a peer or orderer ledger, the leveldbs a ledger lacks are nil
+type Stores struct {
+	Blocks  *index.BlockStore
+	State   *leveldb.DB
+	History *leveldb.DB
+	Pvtdata *leveldb.DB
+}
+
+// Open opens the block store and, for a peer, the state, history and pvtdata dbs below a
+// production directory read-only. Dbs that do not exist are left nil.
+func Open(productionDir string) (*Stores, error) {
+	blocks, err := index.OpenBlockStore(productionDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stores{Blocks: blocks}
+	if blocks.Ledger().IsOrderer() {
+		return s, nil
+	}
+	ledgersData := blocks.Ledger().LedgersDataDir()
+	for name, db := range map[string]**leveldb.DB{State: &s.State, History: &s.History, Pvtdata: &s.Pvtdata} {
+		path := filepath.Join(ledgersData, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+		if *db, err = leveldb.OpenFile(path, &opts); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("error: cannot open %s: [%s], error=[%v]", name, path, err)
+		}
+	}
+	return s, nil
+}
+
+// Close closes every opened store
+func (s *Stores) Close() {
+	for _, db := range []*leveldb.DB{s.State, s.History, s.Pvtdata} {
+		if db != nil {
+			db.Close()
+		}
+	}
+	if s.Blocks != nil {
+		s.Blocks.Close()
+	}
+}
+
+// StoreHeight is the height a store records for a channel
+type StoreHeight struct {
+	Store    string `json:"store"`
+	Present  bool   `json:"present"`   // the store records a height for the channel
+	BlockNum uint64 `json:"block_num"` // last block committed to the store
+	Lag      int64  `json:"lag"`       // blocks behind the blockfiles, negative when ahead
+	Note     string `json:"note,omitempty"`
+}
+
+// Report lines up the heights of the stores of a channel against the blockfiles
+type Report struct {
+	Channel   string `json:"channel"`
+	HasBlocks bool   `json:"has_blocks"`
+	LastBlock uint64 `json:"last_block"` // last complete block in the blockfiles
+	// PartialBytes are the bytes of a block written incompletely at the end of the blockfiles,
+	// the peer truncates them on restart
+	PartialBytes int64         `json:"partial_bytes,omitempty"`
+	Stores       []StoreHeight `json:"stores"`
+	Replay       bool          `json:"replay"` // the peer replays blocks into the state and history dbs on restart
+	ReplayFrom   uint64        `json:"replay_from,omitempty"`
+	Problems     []string      `json:"problems,omitempty"` // inconsistencies the peer does not recover from by itself
+}
+
+// OK reports whether the peer starts without manual intervention
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// JSON returns the report encoded as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary returns a plain-text summary of the report
+func (r *Report) Summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "channel: %s\n", r.Channel)
+	if r.HasBlocks {
+		fmt.Fprintf(&sb, "last block in blockfiles: %d\n", r.LastBlock)
+	} else {
+		sb.WriteString("last block in blockfiles: none\n")
+	}
+	if r.PartialBytes > 0 {
+		fmt.Fprintf(&sb, "partially written block: %d bytes\n", r.PartialBytes)
+	}
+
+	sb.WriteString("\nstores:\n")
+	for _, s := range r.Stores {
+		height := "none"
+		if s.Present {
+			height = fmt.Sprintf("%d", s.BlockNum)
+		}
+		fmt.Fprintf(&sb, "\t%-16s block: %10s  lag: %6d", s.Store, height, s.Lag)
+		if s.Note != "" {
+			fmt.Fprintf(&sb, "  %s", s.Note)
+		}
+		sb.WriteString("\n")
+	}
+
+	if r.Replay {
+		fmt.Fprintf(&sb, "\nreplay on restart: from block %d\n", r.ReplayFrom)
+	} else {
+		sb.WriteString("\nreplay on restart: no\n")
+	}
+	if len(r.Problems) > 0 {
+		sb.WriteString("\nproblems:\n")
+		for _, p := range r.Problems {
+			fmt.Fprintf(&sb, "\t%s\n", p)
+		}
+	}
+	return sb.String()
+}
+
+// CheckAll checks every channel of the ledger
+func (s *Stores) CheckAll() ([]*Report, error) {
+	channels, err := s.Blocks.Ledger().Channels()
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]*Report, 0, len(channels))
+	for _, channel := range channels {
+		r, err := s.Check(channel)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// Check lines up the heights the stores record for a channel against the last block
+// actually present in the blockfiles and explains how the peer recovers on restart
+func (s *Stores) Check(channel string) (*Report, error) {
+	r := &Report{Channel: channel}
+	var err error
+	r.LastBlock, r.HasBlocks, r.PartialBytes, err = lastBlockInFiles(s.Blocks.Ledger().ChannelDir(channel))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.Blocks.BlockfilesInfo(channel)
+	if err != nil && err != index.ErrNotFoundInIndex {
+		return nil, err
+	}
+	if info != nil && !info.NoBlockFiles() {
+		r.add(BlkMgrInfo, info.LastPersistedBlock(), true)
+	} else {
+		r.add(BlkMgrInfo, 0, false)
+	}
+
+	indexed, err := s.Blocks.LastBlockIndexed(channel)
+	if err != nil && err != index.ErrNotFoundInIndex {
+		return nil, err
+	}
+	r.add(Index, indexed, err == nil)
+
+	for _, db := range []struct {
+		name string
+		db   *leveldb.DB
+	}{{State, s.State}, {History, s.History}} {
+		if db.db == nil {
+			continue
+		}
+		blockNum, present, err := savePoint(db.db, channel)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the savepoint of %s, error=[%v]", db.name, err)
+		}
+		r.add(db.name, blockNum, present)
+	}
+	if s.Pvtdata != nil {
+		blockNum, present, err := lastCommittedBlock(s.Pvtdata, channel)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the last committed block of %s, error=[%v]", Pvtdata, err)
+		}
+		r.add(Pvtdata, blockNum, present)
+	}
+	return r, nil
+}
+
+// add records the height of a store and explains its lag
+func (r *Report) add(store string, blockNum uint64, present bool) {
+	var height, blocksHeight int64
+	if present {
+		height = int64(blockNum) + 1
+	}
+	if r.HasBlocks {
+		blocksHeight = int64(r.LastBlock) + 1
+	}
+	h := StoreHeight{Store: store, Present: present, BlockNum: blockNum, Lag: blocksHeight - height}
+	first, last := uint64(height), r.LastBlock
+
+	switch {
+	case h.Lag == 0:
+	case h.Lag > 0 && store == BlkMgrInfo:
+		h.Note = "behind, the peer rescans the last blockfile on restart"
+	case h.Lag > 0 && store == Index:
+		h.Note = fmt.Sprintf("behind, the peer indexes blocks %d-%d on restart", first, last)
+	case h.Lag > 0 && (store == State || store == History):
+		h.Note = fmt.Sprintf("behind, the peer replays blocks %d-%d on restart", first, last)
+		if !r.Replay || first < r.ReplayFrom {
+			r.ReplayFrom = first
+		}
+		r.Replay = true
+	case h.Lag > 0 && store == Pvtdata:
+		h.Note = "behind, private data cannot be replayed from the blockfiles"
+		r.Problems = append(r.Problems, fmt.Sprintf("%s misses the private data of blocks %d-%d", store, first, last))
+	case h.Lag == -1 && store == Pvtdata:
+		// the private data of a block is committed before the block itself
+		h.Note = "ahead by the block being committed, the peer skips its private data on the next commit"
+	default:
+		h.Note = "ahead of the blockfiles"
+		r.Problems = append(r.Problems, fmt.Sprintf("%s records block %d beyond the blockfiles, the store must be rebuilt", store, blockNum))
+	}
+	r.Stores = append(r.Stores, h)
+}
+
+// savePoint returns the last block a state or history db committed for a channel
+func savePoint(db *leveldb.DB, channel string) (uint64, bool, error) {
+	f, err := format.Detect(db)
+	if err != nil {
+		return 0, false, err
+	}
+	// 2.0: <channel>\x00s, 1.x: <channel>\x00\x00
+	key := []byte(channel + "\x00s")
+	if f == format.V1_4 {
+		key = []byte(channel + "\x00\x00")
+	}
+	value, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	h, _, err := version.NewHeightFromBytes(value)
+	if err != nil {
+		return 0, false, err
+	}
+	return h.BlockNum, true, nil
+}
+
+// lastCommittedBlock returns the last block a pvtdataStore committed for a channel
+func lastCommittedBlock(db *leveldb.DB, channel string) (uint64, bool, error) {
+	value, err := db.Get(append([]byte(channel+"\x00"), pvtdata.LastCommittedBlkkey), nil)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	blockNum, n := proto.DecodeVarint(value)
+	if n == 0 {
+		return 0, false, fmt.Errorf("invalid last committed block [%x]", value)
+	}
+	return blockNum, true, nil
+}
+
+// lastBlockInFiles returns the number of the last complete block in the blockfiles of a channel
+// and the size of a partially written block following it
+func lastBlockInFiles(chainDir string) (uint64, bool, int64, error) {
+	files, err := block.BlockFiles(chainDir)
+	if err != nil {
+		return 0, false, 0, err
+	}
+	var partial int64
+	for i := len(files) - 1; i >= 0; i-- {
+		lastBytes, trailing, err := lastBlockBytes(files[i])
+		if err != nil {
+			return 0, false, 0, err
+		}
+		if i == len(files)-1 {
+			partial = trailing
+		}
+		if lastBytes == nil {
+			// a new blockfile is started before its first block is written
+			continue
+		}
+		b, err := block.DeserializeBlock(lastBytes)
+		if err != nil {
+			return 0, false, 0, fmt.Errorf("error: cannot deserialize the last block of [%s], error=[%v]", files[i], err)
+		}
+		return b.Header.Number, true, partial, nil
+	}
+	return 0, false, partial, nil
+}
+
+// lastBlockBytes returns the last complete block of a blockfile and the number of bytes after it
+func lastBlockBytes(path string) ([]byte, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error: cannot open file: [%s], error=[%v]", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error: cannot stat file: [%s], error=[%v]", path, err)
+	}
+
+	var last []byte
+	var offset int64
+	for offset < info.Size() {
+		blockBytes, err := block.ReadBlock(file, offset)
+		if err != nil || blockBytes == nil {
+			break
+		}
+		last = blockBytes
+		offset += int64(proto.SizeVarint(uint64(len(blockBytes)))) + int64(len(blockBytes))
+	}
+	return last, info.Size() - offset, nil
+}
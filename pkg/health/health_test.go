@@ -0,0 +1,92 @@
+package health
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/the-medium/ledger-parser/internal/testutil"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+func putDB(t *testing.T, path string, entries map[string][]byte) {
+	db, err := leveldb.OpenFile(path, nil)
+	assert.NoError(t, err)
+	defer db.Close()
+	for key, value := range entries {
+		assert.NoError(t, db.Put([]byte(key), value, nil))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	root, err := ioutil.TempDir("", "health")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	ts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{{TxID: "genesis", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts}},
+		[]*testutil.Tx{{TxID: "tx1", ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts, MSPID: "Org1MSP", Chaincode: "mycc"}},
+		[]*testutil.Tx{{TxID: "tx2", ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts, MSPID: "Org1MSP", Chaincode: "mycc"}},
+	)
+	assert.NoError(t, err)
+	ledgersData := filepath.Join(root, "ledgersData")
+	chainsDir := filepath.Join(ledgersData, "chains", "chains")
+	assert.NoError(t, testutil.WriteLedger(chainsDir, filepath.Join(ledgersData, "chains", "index"), "mychannel", true, blocks...))
+
+	formatKey := string(format.FormatKey)
+	putDB(t, filepath.Join(ledgersData, State), map[string][]byte{formatKey: []byte("2.0"), "mychannel\x00s": version.NewHeight(1, 0).ToBytes()})
+	putDB(t, filepath.Join(ledgersData, History), map[string][]byte{formatKey: []byte("2.0"), "mychannel\x00s": version.NewHeight(2, 0).ToBytes()})
+	putDB(t, filepath.Join(ledgersData, Pvtdata), map[string][]byte{"mychannel\x00\x01": proto.EncodeVarint(3)})
+
+	// a block whose write was interrupted
+	f, err := os.OpenFile(filepath.Join(chainsDir, "mychannel", "blockfile_000000"), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{0x80, 0x01, 0x0a})
+	assert.NoError(t, err)
+	f.Close()
+
+	stores, err := Open(root)
+	assert.NoError(t, err)
+	reports, err := stores.CheckAll()
+	assert.NoError(t, err)
+	stores.Close()
+	assert.Len(t, reports, 1)
+	r := reports[0]
+	assert.True(t, r.OK(), r.Summary())
+	assert.True(t, r.HasBlocks)
+	assert.Equal(t, uint64(2), r.LastBlock)
+	assert.Equal(t, int64(3), r.PartialBytes)
+	assert.True(t, r.Replay)
+	assert.Equal(t, uint64(2), r.ReplayFrom)
+	assert.Equal(t, []StoreHeight{
+		{Store: BlkMgrInfo, Present: true, BlockNum: 2},
+		{Store: Index, Present: true, BlockNum: 2},
+		{Store: State, Present: true, BlockNum: 1, Lag: 1, Note: "behind, the peer replays blocks 2-2 on restart"},
+		{Store: History, Present: true, BlockNum: 2},
+		{Store: Pvtdata, Present: true, BlockNum: 3, Lag: -1, Note: "ahead by the block being committed, the peer skips its private data on the next commit"},
+	}, r.Stores)
+
+	putDB(t, filepath.Join(ledgersData, History), map[string][]byte{"mychannel\x00s": version.NewHeight(5, 0).ToBytes()})
+	putDB(t, filepath.Join(ledgersData, Pvtdata), map[string][]byte{"mychannel\x00\x01": proto.EncodeVarint(0)})
+	stores, err = Open(root)
+	assert.NoError(t, err)
+	defer stores.Close()
+	r, err = stores.Check("mychannel")
+	assert.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Equal(t, []string{
+		"historyLeveldb records block 5 beyond the blockfiles, the store must be rebuilt",
+		"pvtdataStore misses the private data of blocks 1-2",
+	}, r.Problems)
+	j, err := r.JSON()
+	assert.NoError(t, err)
+	assert.Contains(t, string(j), `"lag": -3`)
+}
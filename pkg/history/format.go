@@ -0,0 +1,56 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/fabric/common/ledger/util"
+)
+
+// fromV14 translates a historyLeveldb key written by a 1.x peer into the 2.0 encoding.
+//
+//	1.x: <channel>\x00<ns>\x00<key>\x00<blockNum><txNum>, savepoint <channel>\x00\x00
+//	2.0: <channel>\x00<ns>\x00<len(key)><key>\x00<blockNum><txNum>, savepoint <channel>\x00s
+//
+// The 1.x key is not length prefixed, so the separator in front of the height is the
+// leftmost nil byte followed by exactly two order preserving numbers that use up the rest
+// of the key. Searching from the end instead would stop inside a height whose encoding
+// ends in zero bytes, e.g. block 65536 at tx 0.
+func fromV14(key []byte) ([]byte, error) {
+	nsKey := bytes.SplitN(key, []byte{0x00}, 2)
+	if len(nsKey) != 2 || len(nsKey[1]) == 0 {
+		return nil, fmt.Errorf("invalid 1.x history key [%x]", key)
+	}
+	channel := append(append([]byte{}, nsKey[0]...), 0x00)
+	if bytes.Equal(nsKey[1], []byte{0x00}) {
+		return append(channel, 's'), nil
+	}
+
+	nsRest := bytes.SplitN(nsKey[1], []byte{0x00}, 2)
+	if len(nsRest) != 2 {
+		return nil, fmt.Errorf("invalid 1.x history key [%x]", key)
+	}
+	ns, rest := nsRest[0], nsRest[1]
+	for i := 0; i < len(rest); i++ {
+		if rest[i] != 0x00 || !isHeight(rest[i+1:]) {
+			continue
+		}
+		realKey := rest[:i]
+		k := append(channel, ns...)
+		k = append(k, 0x00)
+		k = append(k, util.EncodeOrderPreservingVarUint64(uint64(len(realKey)))...)
+		k = append(k, realKey...)
+		return append(k, rest[i:]...), nil
+	}
+	return nil, fmt.Errorf("no block and transaction number found in 1.x history key [%x]", key)
+}
+
+// isHeight reports whether b consists of exactly two order preserving encoded numbers
+func isHeight(b []byte) bool {
+	_, n1, err := util.DecodeOrderPreservingVarUint64(b)
+	if err != nil || n1 >= len(b) {
+		return false
+	}
+	_, n2, err := util.DecodeOrderPreservingVarUint64(b[n1:])
+	return err == nil && n1+n2 == len(b)
+}
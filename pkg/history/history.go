@@ -2,13 +2,27 @@ package history
 
 import (
 	"bytes"
+
+	"github.com/the-medium/ledger-parser/pkg/format"
 )
 
 func ParseKV(key []byte, value []byte, channel string) (kvSet KVSet, err error) {
+	return ParseKVWithFormat(key, value, channel, format.V2_0)
+}
+
+// ParseKVWithFormat is ParseKV for a historyLeveldb written in the given data format.
+// Entries of a 1.x db are translated into the 2.0 encoding first.
+func ParseKVWithFormat(key []byte, value []byte, channel string, f format.Version) (kvSet KVSet, err error) {
 	nsKey := bytes.SplitN(key, []byte{0x00}, 2)
 	if string(nsKey[0]) != channel && channel != "" {
 		return nil, nil
 	}
+	if f == format.V1_4 {
+		if key, err = fromV14(key); err != nil {
+			return nil, err
+		}
+		nsKey = bytes.SplitN(key, []byte{0x00}, 2)
+	}
 
 	ccInternalKey := nsKey[1]
 
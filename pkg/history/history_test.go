@@ -2,11 +2,23 @@ package history
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/stretchr/testify/assert"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/the-medium/ledger-parser/internal/testutil"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
 )
 
 func TestMain(m *testing.M) {
@@ -16,7 +28,7 @@ func TestMain(m *testing.M) {
 	db, err := leveldb.OpenFile(path, &opts)
 	if err != nil {
 		fmt.Println(err.Error())
-		return
+		os.Exit(m.Run())
 	}
 	defer db.Close()
 
@@ -33,3 +45,289 @@ func TestMain(m *testing.M) {
 	}
 	os.Exit(m.Run())
 }
+
+func TestParseKVV14(t *testing.T) {
+	for _, test := range []struct {
+		key             string
+		blockNum, txNum uint64
+	}{
+		{"k1", 0, 0},
+		{"k1", 1, 2},
+		{"k1", 256, 0},
+		{"k1", 65536, 0},
+		{"k1", 1, 65536},
+		{"k1", 1 << 32, 0},
+		{"\x00asset\x00a\x00", 65536, 0},
+	} {
+		key := append([]byte("mychannel\x00mycc\x00"+test.key+"\x00"), version.NewHeight(test.blockNum, test.txNum).ToBytes()...)
+		kv, err := ParseKVWithFormat(key, []byte{}, "mychannel", format.V1_4)
+		assert.NoError(t, err)
+		general, ok := kv.(*GeneralKV)
+		if !assert.True(t, ok, "%x", key) {
+			continue
+		}
+		hk, err := general.Decode()
+		assert.NoError(t, err)
+		assert.Equal(t, &HistoryKey{Channel: "mychannel", Namespace: "mycc", Key: test.key, BlockNum: test.blockNum, TxNum: test.txNum}, hk)
+		assert.Equal(t, DataKey("mychannel", "mycc", test.key, test.blockNum, test.txNum), general.Key())
+	}
+
+	kv, err := ParseKVWithFormat([]byte("mychannel\x00\x00"), version.NewHeight(3, 1).ToBytes(), "mychannel", format.V1_4)
+	assert.NoError(t, err)
+	assert.IsType(t, &SavePointKV{}, kv)
+}
+
+func putHistory(t *testing.T, db *leveldb.DB, ns, key string, blockNum, txNum uint64) {
+	assert.NoError(t, db.Put(DataKey("mychannel", ns, key, blockNum, txNum), []byte{}, nil))
+}
+
+func TestGetHistoryForKey(t *testing.T) {
+	root, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	ts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	write := func(txID, mspID string, writes ...*kvrwset.KVWrite) *testutil.Tx {
+		return &testutil.Tx{
+			TxID: txID, ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION,
+			Timestamp: ts.Add(time.Minute * time.Duration(len(txID))), MSPID: mspID, Chaincode: "mycc",
+			RWSet: &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{{NameSpace: "mycc", KvRwSet: &kvrwset.KVRWSet{Writes: writes}}}},
+		}
+	}
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{{TxID: "genesis", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts}},
+		[]*testutil.Tx{write("tx1", "Org1MSP", &kvrwset.KVWrite{Key: "k1", Value: []byte("v1")}, &kvrwset.KVWrite{Key: "k10", Value: []byte("v")})},
+		[]*testutil.Tx{write("tx02", "Org2MSP", &kvrwset.KVWrite{Key: "k1", Value: []byte("v2")}), write("tx003", "Org1MSP", &kvrwset.KVWrite{Key: "k1", IsDelete: true})},
+	)
+	assert.NoError(t, err)
+	ledgersData := filepath.Join(root, "ledgersData")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(ledgersData, "chains", "chains"), filepath.Join(ledgersData, "chains", "index"), "mychannel", true, blocks...))
+
+	db, err := leveldb.OpenFile(filepath.Join(ledgersData, "historyLeveldb"), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	putHistory(t, db, "mycc", "k1", 1, 0)
+	putHistory(t, db, "mycc", "k10", 1, 0)
+	putHistory(t, db, "mycc", "k1", 2, 0)
+	putHistory(t, db, "mycc", "k1", 2, 1)
+	putHistory(t, db, "othercc", "k1", 1, 0)
+	db.Close()
+
+	q, err := OpenQuerier(root)
+	assert.NoError(t, err)
+	defer q.Close()
+	mods, err := q.GetHistoryForKey("mychannel", "mycc", "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, []*KeyModification{
+		{TxID: "tx003", Timestamp: ts.Add(5 * time.Minute), IsDelete: true, Creator: "Org1MSP", BlockNum: 2, TxNum: 1},
+		{TxID: "tx02", Timestamp: ts.Add(4 * time.Minute), Value: []byte("v2"), Creator: "Org2MSP", BlockNum: 2, TxNum: 0},
+		{TxID: "tx1", Timestamp: ts.Add(3 * time.Minute), Value: []byte("v1"), Creator: "Org1MSP", BlockNum: 1, TxNum: 0},
+	}, mods)
+
+	mods, err = q.GetHistoryForKey("mychannel", "mycc", "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, mods)
+
+	// the history points to a transaction that does not write the key
+	_, err = q.GetHistoryForKey("mychannel", "othercc", "k1")
+	assert.Error(t, err)
+
+	// the same history written by a 1.x peer, with a longer key sharing the prefix of the 1.x encoding
+	db, err = leveldb.OpenFile(filepath.Join(root, "historyV14"), nil)
+	assert.NoError(t, err)
+	defer db.Close()
+	for _, e := range []struct {
+		key             string
+		blockNum, txNum uint64
+	}{{"k1", 1, 0}, {"k1\x00x", 1, 0}, {"k1", 2, 0}, {"k1", 2, 1}} {
+		k := append([]byte("mychannel\x00mycc\x00"+e.key+"\x00"), version.NewHeight(e.blockNum, e.txNum).ToBytes()...)
+		assert.NoError(t, db.Put(k, []byte{}, nil))
+	}
+	q14, err := NewQuerier(db, q.store)
+	assert.NoError(t, err)
+	mods14, err := q14.GetHistoryForKey("mychannel", "mycc", "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tx003", "tx02", "tx1"}, []string{mods14[0].TxID, mods14[1].TxID, mods14[2].TxID})
+
+	// an entry whose height does not decode is an error, not a missing write
+	assert.NoError(t, db.Put([]byte("mychannel\x00mycc\x00k1\x00\x09\x01"), []byte{}, nil))
+	_, err = q14.GetHistoryForKey("mychannel", "mycc", "k1")
+	assert.Error(t, err)
+}
+
+func TestRebuild(t *testing.T) {
+	root, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	ts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	write := func(txID string, code peer.TxValidationCode, nsRwSets ...*rwsetutil.NsRwSet) *testutil.Tx {
+		return &testutil.Tx{
+			TxID: txID, ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts,
+			MSPID: "Org1MSP", Chaincode: "mycc", RWSet: &rwsetutil.TxRwSet{NsRwSets: nsRwSets}, ValidationCode: code,
+		}
+	}
+	kvWrites := func(ns string, keys ...string) *rwsetutil.NsRwSet {
+		writes := make([]*kvrwset.KVWrite, 0, len(keys))
+		for _, k := range keys {
+			writes = append(writes, &kvrwset.KVWrite{Key: k, Value: []byte("v")})
+		}
+		return &rwsetutil.NsRwSet{NameSpace: ns, KvRwSet: &kvrwset.KVRWSet{Writes: writes}}
+	}
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{{TxID: "genesis", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts}},
+		[]*testutil.Tx{
+			write("tx1", peer.TxValidationCode_VALID, kvWrites("mycc", "k1", "asset\x00a\x00")),
+			write("tx2", peer.TxValidationCode_MVCC_READ_CONFLICT, kvWrites("mycc", "k2")),
+			write("tx3", peer.TxValidationCode_VALID, kvWrites("mycc", "k1"), kvWrites("othercc", "k1")),
+		},
+		// the peer never decodes an invalid transaction, its payload may be garbage
+		[]*testutil.Tx{
+			{TxID: "bad", ValidationCode: peer.TxValidationCode_BAD_PAYLOAD, Malformed: true},
+			write("tx4", peer.TxValidationCode_VALID, kvWrites("mycc", "k2")),
+		},
+	)
+	assert.NoError(t, err)
+	ledgersData := filepath.Join(root, "ledgersData")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(ledgersData, "chains", "chains"), filepath.Join(ledgersData, "chains", "index"), "mychannel", true, blocks...))
+
+	ledger, err := block.OpenLedger(root)
+	assert.NoError(t, err)
+	stats, err := RebuildDir(ledger, filepath.Join(ledgersData, "historyLeveldb"))
+	assert.NoError(t, err)
+	assert.Equal(t, []*RebuildStats{{Channel: "mychannel", Blocks: 3, Transactions: 3, Entries: 5, SavePoint: version.NewHeight(2, 2)}}, stats)
+
+	// the history of a channel is only written into a db without it
+	_, err = RebuildDir(ledger, filepath.Join(ledgersData, "historyLeveldb"), "mychannel")
+	assert.Error(t, err)
+
+	db, err := leveldb.OpenFile(filepath.Join(ledgersData, "historyLeveldb"), &opt.Options{ReadOnly: true})
+	assert.NoError(t, err)
+	f, err := format.Detect(db)
+	assert.NoError(t, err)
+	assert.Equal(t, format.V2_0, f)
+	var entries []HistoryKey
+	var savePoint []byte
+	iter := db.NewIterator(nil, nil)
+	for iter.Next() {
+		kv, err := ParseKV(iter.Key(), iter.Value(), "mychannel")
+		assert.NoError(t, err)
+		switch kv := kv.(type) {
+		case *GeneralKV:
+			hk, err := kv.Decode()
+			assert.NoError(t, err)
+			entries = append(entries, *hk)
+			assert.Empty(t, kv.Value())
+		case *SavePointKV:
+			savePoint = append([]byte{}, iter.Value()...)
+		}
+	}
+	iter.Release()
+	db.Close()
+	assert.Equal(t, []HistoryKey{
+		{Channel: "mychannel", Namespace: "mycc", Key: "k1", BlockNum: 1, TxNum: 0},
+		{Channel: "mychannel", Namespace: "mycc", Key: "k1", BlockNum: 1, TxNum: 2},
+		{Channel: "mychannel", Namespace: "mycc", Key: "k2", BlockNum: 2, TxNum: 1},
+		{Channel: "mychannel", Namespace: "mycc", Key: "asset\x00a\x00", BlockNum: 1, TxNum: 0},
+		{Channel: "mychannel", Namespace: "othercc", Key: "k1", BlockNum: 1, TxNum: 2},
+	}, entries)
+	assert.Equal(t, version.NewHeight(2, 2).ToBytes(), savePoint)
+
+	q, err := OpenQuerier(root)
+	assert.NoError(t, err)
+	defer q.Close()
+	mods, err := q.GetHistoryForKey("mychannel", "mycc", "k1")
+	assert.NoError(t, err)
+	assert.Len(t, mods, 2)
+	assert.Equal(t, "tx3", mods[0].TxID)
+}
+
+func TestVerify(t *testing.T) {
+	root, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	ts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	write := func(txID string, code peer.TxValidationCode, keys ...string) *testutil.Tx {
+		writes := make([]*kvrwset.KVWrite, 0, len(keys))
+		for _, k := range keys {
+			writes = append(writes, &kvrwset.KVWrite{Key: k, Value: []byte("v")})
+		}
+		return &testutil.Tx{
+			TxID: txID, ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts, MSPID: "Org1MSP", Chaincode: "mycc",
+			RWSet:          &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{{NameSpace: "mycc", KvRwSet: &kvrwset.KVRWSet{Writes: writes}}}},
+			ValidationCode: code,
+		}
+	}
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{{TxID: "genesis", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts}},
+		[]*testutil.Tx{write("tx1", peer.TxValidationCode_VALID, "k1", "k2"), write("tx2", peer.TxValidationCode_MVCC_READ_CONFLICT, "k3")},
+		[]*testutil.Tx{write("tx3", peer.TxValidationCode_VALID, "k1"), {TxID: "bad", ValidationCode: peer.TxValidationCode_BAD_PAYLOAD, Malformed: true}},
+	)
+	assert.NoError(t, err)
+	ledgersData := filepath.Join(root, "ledgersData")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(ledgersData, "chains", "chains"), filepath.Join(ledgersData, "chains", "index"), "mychannel", true, blocks...))
+	ledger, err := block.OpenLedger(root)
+	assert.NoError(t, err)
+	_, err = RebuildDir(ledger, filepath.Join(ledgersData, "historyLeveldb"))
+	assert.NoError(t, err)
+
+	r, err := VerifyDir(root, "mychannel")
+	assert.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.Equal(t, 3, r.Entries)
+	assert.Equal(t, 3, r.Verified)
+	assert.Equal(t, version.NewHeight(2, 2), r.SavePoint)
+
+	db, err := leveldb.OpenFile(filepath.Join(ledgersData, "historyLeveldb"), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Delete(DataKey("mychannel", "mycc", "k2", 1, 0), nil))
+	// block 2 is not committed to the history yet
+	assert.NoError(t, db.Delete(DataKey("mychannel", "mycc", "k1", 2, 0), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00s"), version.NewHeight(1, 2).ToBytes(), nil))
+	putHistory(t, db, "mycc", "k3", 1, 1)
+	putHistory(t, db, "mycc", "k9", 1, 0)
+	putHistory(t, db, "mycc", "k1", 5, 0)
+	putHistory(t, db, "mycc", "k1", 0, 0)
+	putHistory(t, db, "mycc", "k1", 2, 1)
+	db.Close()
+
+	r, err = VerifyDir(root, "mychannel")
+	assert.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Equal(t, uint64(2), r.LastBlock)
+	assert.Equal(t, 6, r.Entries)
+	assert.Equal(t, 1, r.Verified)
+	assert.Equal(t, 1, r.Pending)
+	assert.Equal(t, []Issue{
+		{Namespace: "mycc", Key: "k1", BlockNum: 0, TxNum: 0, TxID: "genesis", Detail: "transaction of type CONFIG has no write set"},
+		{Namespace: "mycc", Key: "k1", BlockNum: 2, TxNum: 1, Detail: "transaction is invalid (BAD_PAYLOAD)"},
+		{Namespace: "mycc", Key: "k1", BlockNum: 5, TxNum: 0, Detail: "block not in the blockfiles"},
+		{Namespace: "mycc", Key: "k3", BlockNum: 1, TxNum: 1, Detail: "transaction is invalid (MVCC_READ_CONFLICT)"},
+		{Namespace: "mycc", Key: "k9", BlockNum: 1, TxNum: 0, TxID: "tx1", Detail: "transaction does not write the key"},
+	}, r.Extras)
+	assert.Equal(t, []Issue{
+		{Namespace: "mycc", Key: "k2", BlockNum: 1, TxNum: 0, TxID: "tx1", Detail: "valid write without history entry"},
+	}, r.Gaps)
+	assert.Contains(t, r.Summary(), "gaps: 1\n")
+
+	// a peer bootstrapped from a snapshot at block 1 has no blockfiles and no history before block 2
+	snapshotRoot := filepath.Join(root, "snapshot")
+	snapshotData := filepath.Join(snapshotRoot, "ledgersData")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(snapshotData, "chains", "chains"), filepath.Join(snapshotData, "chains", "index"), "mychannel", true, blocks[2:]...))
+	db, err = leveldb.OpenFile(filepath.Join(snapshotData, "historyLeveldb"), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00s"), version.NewHeight(2, 1).ToBytes(), nil))
+	putHistory(t, db, "mycc", "k1", 1, 0)
+	putHistory(t, db, "mycc", "k1", 2, 0)
+	db.Close()
+
+	r, err = VerifyDir(snapshotRoot, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), r.FirstBlock)
+	assert.Equal(t, 2, r.Entries)
+	assert.Equal(t, 1, r.Verified)
+	assert.Equal(t, []Issue{{Namespace: "mycc", Key: "k1", BlockNum: 1, TxNum: 0, Detail: "block not in the blockfiles"}}, r.Extras)
+	assert.Empty(t, r.Gaps)
+}
@@ -0,0 +1,159 @@
+package history
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/common/ledger/util"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/index"
+)
+
+// KeyModification is a write of a key, as returned by the chaincode GetHistoryForKey API
+// with the creator of the transaction and its position in the chain
+type KeyModification struct {
+	TxID      string
+	Timestamp time.Time
+	Value     []byte // nil for deletes
+	IsDelete  bool
+	Creator   string // MSP id of the submitting client
+	BlockNum  uint64
+	TxNum     uint64
+}
+
+// Querier answers key history queries from a historyLeveldb, reading the writes from the blockfiles
+type Querier struct {
+	db     *leveldb.DB
+	format format.Version
+	store  *index.BlockStore
+}
+
+// NewQuerier returns a Querier on an opened historyLeveldb and the block store of the same peer.
+// An empty db holds nothing to misread and is read as 2.0.
+func NewQuerier(db *leveldb.DB, store *index.BlockStore) (*Querier, error) {
+	f, err := format.Detect(db)
+	if err == format.ErrEmptyDB {
+		f, err = format.V2_0, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot detect the format of the history db, error=[%v]", err)
+	}
+	return &Querier{db: db, format: f, store: store}, nil
+}
+
+// OpenQuerier opens the historyLeveldb and the block store below a peer production directory read-only
+func OpenQuerier(productionDir string) (*Querier, error) {
+	store, err := index.OpenBlockStore(productionDir)
+	if err != nil {
+		return nil, err
+	}
+	if store.Ledger().IsOrderer() {
+		store.Close()
+		return nil, fmt.Errorf("error: an orderer ledger has no history db: [%s]", productionDir)
+	}
+	path := filepath.Join(store.Ledger().LedgersDataDir(), "historyLeveldb")
+	opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+	db, err := leveldb.OpenFile(path, &opts)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("error: cannot open history db: [%s], error=[%v]", path, err)
+	}
+	q, err := NewQuerier(db, store)
+	if err != nil {
+		db.Close()
+		store.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Close closes the history db and the block store
+func (q *Querier) Close() error {
+	q.store.Close()
+	return q.db.Close()
+}
+
+// keyPrefix encodes the prefix of the history entries of a key:
+// <channel>\x00<ns>\x00<len(key)><key>\x00, or <channel>\x00<ns>\x00<key>\x00 in 1.x
+func (q *Querier) keyPrefix(channel, ns, key string) []byte {
+	k := []byte(channel + "\x00" + ns + "\x00")
+	if q.format != format.V1_4 {
+		k = append(k, util.EncodeOrderPreservingVarUint64(uint64(len(key)))...)
+	}
+	return append(append(k, key...), 0x00)
+}
+
+// GetHistoryForKey returns the committed writes of a public key, newest first like the
+// chaincode API since Fabric 2.0. Each write is read from its transaction in the blockfiles.
+func (q *Querier) GetHistoryForKey(channel, ns, key string) ([]*KeyModification, error) {
+	var mods []*KeyModification
+	iter := q.db.NewIterator(lutil.BytesPrefix(q.keyPrefix(channel, ns, key)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := ParseKVWithFormat(iter.Key(), iter.Value(), channel, q.format)
+		if err != nil {
+			return nil, err
+		}
+		general, ok := kv.(*GeneralKV)
+		if !ok {
+			continue
+		}
+		hk, err := general.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if hk.Namespace != ns || hk.Key != key {
+			// a 1.x prefix also matches longer keys starting with key\x00
+			if q.format == format.V1_4 && hk.Namespace == ns && strings.HasPrefix(hk.Key, key+"\x00") {
+				continue
+			}
+			return nil, fmt.Errorf("history entry [%x] decodes to [%s/%q], not to the queried key", iter.Key(), hk.Namespace, hk.Key)
+		}
+		mod, err := q.modification(channel, ns, key, hk.BlockNum, hk.TxNum)
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(mods)-1; i < j; i, j = i+1, j-1 {
+		mods[i], mods[j] = mods[j], mods[i]
+	}
+	return mods, nil
+}
+
+// modification reads the write of the key from the transaction at blockNum, txNum
+func (q *Querier) modification(channel, ns, key string, blockNum, txNum uint64) (*KeyModification, error) {
+	env, err := q.store.RetrieveTxByBlockNumTranNum(channel, blockNum, txNum)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := block.DecodeEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+	mod := &KeyModification{
+		TxID:      tx.TxID,
+		Timestamp: tx.Timestamp,
+		Creator:   tx.CreatorMSPID,
+		BlockNum:  blockNum,
+		TxNum:     txNum,
+	}
+	w := findWrite(tx, ns, key)
+	if w == nil {
+		return nil, fmt.Errorf("transaction [%s] at block [%d] tx [%d] does not write [%s]", tx.TxID, blockNum, txNum, key)
+	}
+	mod.Value, mod.IsDelete = w.Value, w.IsDelete
+	if mod.IsDelete {
+		mod.Value = nil
+	}
+	return mod, nil
+}
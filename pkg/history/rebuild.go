@@ -0,0 +1,170 @@
+package history
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/common/ledger/util"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+// RebuildStats counts what a Rebuilder wrote for a channel
+type RebuildStats struct {
+	Channel      string          `json:"channel"`
+	Blocks       uint64          `json:"blocks"`
+	Transactions uint64          `json:"transactions"` // valid endorser transactions
+	Entries      uint64          `json:"entries"`
+	SavePoint    *version.Height `json:"savepoint"`
+}
+
+// Rebuilder writes the history entries of the blocks of a channel into a historyLeveldb in the
+// 2.0 format, the way the peer commits them: an empty valued entry for every public write of
+// a valid endorser transaction and the savepoint after each block
+type Rebuilder struct {
+	db        *leveldb.DB
+	stats     RebuildStats
+	lastBlock *uint64
+}
+
+// NewRebuilder returns a Rebuilder writing into db, which must not hold history for the channel yet.
+// An empty db gets the format key.
+func NewRebuilder(db *leveldb.DB, channel string) (*Rebuilder, error) {
+	_, err := db.Get(format.FormatKey, nil)
+	switch {
+	case err == leveldb.ErrNotFound:
+		if !isEmpty(db) {
+			return nil, fmt.Errorf("error: the db has no format key but holds data, it is not a 2.0 history db")
+		}
+		if err := db.Put(format.FormatKey, []byte(format.V2_0), nil); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		f, err := format.Detect(db)
+		if err != nil {
+			return nil, err
+		}
+		if f != format.V2_0 {
+			return nil, fmt.Errorf("error: cannot rebuild into a history db of format [%s]", f)
+		}
+	}
+	if _, err := db.Get(savePointKey(channel), nil); err != leveldb.ErrNotFound {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error: the db already holds history for channel [%s], remove it first", channel)
+	}
+	return &Rebuilder{db: db, stats: RebuildStats{Channel: channel}}, nil
+}
+
+func isEmpty(db *leveldb.DB) bool {
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	return !iter.Next()
+}
+
+func savePointKey(channel string) []byte {
+	return []byte(channel + "\x00s")
+}
+
+// DataKey encodes a 2.0 history entry: <channel>\x00<ns>\x00<len(key)><key>\x00<blockNum><txNum>
+func DataKey(channel, ns, key string, blockNum, txNum uint64) []byte {
+	k := []byte(channel + "\x00" + ns + "\x00")
+	k = append(k, util.EncodeOrderPreservingVarUint64(uint64(len(key)))...)
+	k = append(append(k, key...), 0x00)
+	return append(k, version.NewHeight(blockNum, txNum).ToBytes()...)
+}
+
+// Rebuild writes the history of all blocks of a channel into db
+func Rebuild(ledger *block.Ledger, db *leveldb.DB, channel string) (*RebuildStats, error) {
+	r, err := NewRebuilder(db, channel)
+	if err != nil {
+		return nil, err
+	}
+	if err := ledger.WalkBlocks(channel, r.AddBlock); err != nil {
+		return nil, err
+	}
+	return r.Stats(), nil
+}
+
+// RebuildDir creates the history db at path, or opens it when it exists, and rebuilds the
+// history of the given channels, of every channel of the ledger when none are given
+func RebuildDir(ledger *block.Ledger, path string, channels ...string) ([]*RebuildStats, error) {
+	if len(channels) == 0 {
+		var err error
+		if channels, err = ledger.Channels(); err != nil {
+			return nil, err
+		}
+	}
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot open history db: [%s], error=[%v]", path, err)
+	}
+	defer db.Close()
+	stats := make([]*RebuildStats, 0, len(channels))
+	for _, channel := range channels {
+		s, err := Rebuild(ledger, db, channel)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// Stats returns what was written so far
+func (r *Rebuilder) Stats() *RebuildStats {
+	s := r.stats
+	return &s
+}
+
+// AddBlock writes the history entries and the savepoint of the next block in a single batch
+func (r *Rebuilder) AddBlock(b block.Block) error {
+	cb := b.GetBlock()
+	blockNum := cb.GetHeader().GetNumber()
+	if r.lastBlock != nil && blockNum != *r.lastBlock+1 {
+		return fmt.Errorf("expected block [%d], got block [%d]", *r.lastBlock+1, blockNum)
+	}
+	batch := new(leveldb.Batch)
+	var entries uint64
+	data := cb.GetData().GetData()
+	for txNum := range data {
+		// like the peer, check the filter first and never decode an invalid transaction
+		if block.GetValidationCode(cb, txNum) != peer.TxValidationCode_VALID {
+			continue
+		}
+		tx, err := block.GetTransaction(cb, txNum)
+		if err != nil {
+			return err
+		}
+		if tx.Type != common.HeaderType_ENDORSER_TRANSACTION || tx.RWSet == nil {
+			continue
+		}
+		r.stats.Transactions++
+		for _, nsRwSet := range tx.RWSet.NsRwSets {
+			if nsRwSet.KvRwSet == nil {
+				continue
+			}
+			for _, w := range nsRwSet.KvRwSet.Writes {
+				batch.Put(DataKey(r.stats.Channel, nsRwSet.NameSpace, w.Key, tx.BlockNum, tx.TxNum), []byte{})
+				entries++
+			}
+		}
+	}
+	// the peer records the number of transactions of the block as the tx number of the savepoint
+	savePoint := version.NewHeight(blockNum, uint64(len(data)))
+	batch.Put(savePointKey(r.stats.Channel), savePoint.ToBytes())
+	if err := r.db.Write(batch, nil); err != nil {
+		return err
+	}
+	r.stats.Blocks++
+	r.stats.Entries += entries
+	r.stats.SavePoint = savePoint
+	r.lastBlock = &blockNum
+	return nil
+}
@@ -205,54 +205,72 @@ func (kv GeneralKV) Key() []byte {
 }
 
 func (kv GeneralKV) Location() (uint64, uint64, error) {
-	ccInternalKey := bytes.SplitN(kv.key, []byte{0x00}, 2)[1]
-	internalKey := bytes.SplitN(ccInternalKey, []byte{0x00}, 2)[1]
-
-	loc := bytes.SplitN(internalKey, []byte{0x00}, 2)[1]
-
-	offset := 1
-	blockNumSize := utils.GetInt(loc[0:offset])
-	blockNum, offset, err := util.DecodeOrderPreservingVarUint64(loc[0 : offset+blockNumSize+1])
+	hk, err := kv.Decode()
 	if err != nil {
 		return 0, 0, err
 	}
+	return hk.BlockNum, hk.TxNum, nil
+}
+
+// HistoryKey is a decoded historyLeveldb data key:
+// <channel>\x00<ns>\x00<len(key)><key>\x00<blockNum><txNum>
+type HistoryKey struct {
+	Channel   string
+	Namespace string
+	Key       string
+	BlockNum  uint64
+	TxNum     uint64
+}
+
+// Decode splits the key using its length prefix, so keys containing nil bytes
+// (e.g. composite keys) are decoded correctly
+func (kv GeneralKV) Decode() (*HistoryKey, error) {
+	return decodeHistoryKey(kv.key)
+}
 
-	txNumSize := utils.GetInt(loc[offset : offset+1])
-	txNum, _, err := util.DecodeOrderPreservingVarUint64(loc[offset : offset+txNumSize+1])
+func decodeHistoryKey(key []byte) (*HistoryKey, error) {
+	channelKey := bytes.SplitN(key, []byte{0x00}, 2)
+	if len(channelKey) != 2 {
+		return nil, fmt.Errorf("invalid history key [%x]", key)
+	}
+	nsKey := bytes.SplitN(channelKey[1], []byte{0x00}, 2)
+	if len(nsKey) != 2 {
+		return nil, fmt.Errorf("invalid history key [%x]", key)
+	}
+	keyLen, n, err := util.DecodeOrderPreservingVarUint64(nsKey[1])
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
-
-	return blockNum, txNum, nil
+	rest := nsKey[1][n:]
+	if uint64(len(rest)) < keyLen+1 || rest[keyLen] != 0x00 {
+		return nil, fmt.Errorf("invalid history key [%x]", key)
+	}
+	height, _, err := utils.NewHeightFromBytes(rest[keyLen+1:])
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryKey{
+		Channel:   string(channelKey[0]),
+		Namespace: string(nsKey[0]),
+		Key:       string(rest[:keyLen]),
+		BlockNum:  height.BlockNum,
+		TxNum:     height.TxNum,
+	}, nil
 }
 
 func (kv GeneralKV) Print() {
-	channel := string(bytes.SplitN(kv.key, []byte{0x00}, 2)[0])
-	ccInternalKey := bytes.SplitN(kv.key, []byte{0x00}, 2)[1]
-	internalKey := bytes.SplitN(ccInternalKey, []byte{0x00}, 2)[1]
-	offset := 1
-
-	size := utils.GetInt([]byte{internalKey[0]})
-	offset += size
-
-	keySize := utils.GetInt(internalKey[1:offset])
-	offset += keySize
-
-	realKey := string(internalKey[1+size : offset])
-	offset++
-
-	blockNum, txNum, err := kv.Location()
+	hk, err := kv.Decode()
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
 
 	msg := fmt.Sprintf("<GeneralKV>\n")
-	msg += fmt.Sprintf("channel: %s\n", channel)
-	msg += fmt.Sprintf("RealKey: %s\n", realKey)
+	msg += fmt.Sprintf("channel: %s\n", hk.Channel)
+	msg += fmt.Sprintf("RealKey: %s\n", hk.Key)
 	msg += fmt.Sprintf("RealValue: %s\n", kv.value)
-	msg += fmt.Sprintf("Block Number: %d\n", blockNum)
-	msg += fmt.Sprintf("Tx Number: %d\n", txNum)
+	msg += fmt.Sprintf("Block Number: %d\n", hk.BlockNum)
+	msg += fmt.Sprintf("Tx Number: %d\n", hk.TxNum)
 	fmt.Println(msg)
 }
 
@@ -0,0 +1,288 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/index"
+)
+
+// Issue is a history entry without a matching write in the blocks, or a write without an entry
+type Issue struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	BlockNum  uint64 `json:"block_num"`
+	TxNum     uint64 `json:"tx_num"`
+	TxID      string `json:"tx_id,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s/%q at %d:%d: %s", i.Namespace, i.Key, i.BlockNum, i.TxNum, i.Detail)
+}
+
+// VerifyReport is the result of checking the history of a channel against its blocks
+type VerifyReport struct {
+	Channel    string          `json:"channel"`
+	SavePoint  *version.Height `json:"savepoint"`   // nil if the db holds no history for the channel
+	FirstBlock uint64          `json:"first_block"` // above 0 for a ledger bootstrapped from a snapshot
+	LastBlock  uint64          `json:"last_block"`
+	Entries    int             `json:"entries"`
+	Verified   int             `json:"verified"`
+	// Pending are the writes of blocks after the savepoint, the peer adds them on restart
+	Pending int     `json:"pending"`
+	Extras  []Issue `json:"extras,omitempty"` // entries not backed by a valid write
+	Gaps    []Issue `json:"gaps,omitempty"`   // valid writes up to the savepoint without an entry
+}
+
+// OK reports whether every entry is backed by a valid write and every committed write has an entry
+func (r *VerifyReport) OK() bool {
+	return len(r.Extras) == 0 && len(r.Gaps) == 0
+}
+
+// JSON returns the report encoded as indented JSON
+func (r *VerifyReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary returns a plain-text summary of the report
+func (r *VerifyReport) Summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "channel: %s\n", r.Channel)
+	if r.SavePoint != nil {
+		fmt.Fprintf(&sb, "savepoint: block %d\n", r.SavePoint.BlockNum)
+	} else {
+		sb.WriteString("savepoint: none\n")
+	}
+	fmt.Fprintf(&sb, "blocks in blockfiles: %d-%d\n", r.FirstBlock, r.LastBlock)
+	fmt.Fprintf(&sb, "entries: %d\n", r.Entries)
+	fmt.Fprintf(&sb, "verified: %d\n", r.Verified)
+	fmt.Fprintf(&sb, "pending: %d\n", r.Pending)
+	fmt.Fprintf(&sb, "extras: %d\n", len(r.Extras))
+	fmt.Fprintf(&sb, "gaps: %d\n", len(r.Gaps))
+	for _, section := range []struct {
+		name   string
+		issues []Issue
+	}{{"extras", r.Extras}, {"gaps", r.Gaps}} {
+		if len(section.issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s:\n", section.name)
+		for _, i := range section.issues {
+			fmt.Fprintf(&sb, "\t%s\n", i)
+		}
+	}
+	return sb.String()
+}
+
+// VerifyDir checks the historyLeveldb below a peer production directory against the blockfiles
+func VerifyDir(productionDir, channel string) (*VerifyReport, error) {
+	store, err := index.OpenBlockStore(productionDir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if store.Ledger().IsOrderer() {
+		return nil, fmt.Errorf("error: an orderer ledger has no history db: [%s]", productionDir)
+	}
+	path := filepath.Join(store.Ledger().LedgersDataDir(), "historyLeveldb")
+	opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+	db, err := leveldb.OpenFile(path, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot open history db: [%s], error=[%v]", path, err)
+	}
+	defer db.Close()
+	return Verify(store, db, channel)
+}
+
+// Verify checks the history of a channel against its blocks in two passes that hold no more
+// than a block in memory. The blocks are walked to look up the entry of every public write of
+// a valid endorser transaction up to the savepoint. Then every history entry is resolved through
+// the block index: the transaction it points to must be valid and write its namespace and key.
+func Verify(store *index.BlockStore, db *leveldb.DB, channel string) (*VerifyReport, error) {
+	f, err := format.Detect(db)
+	if err == format.ErrEmptyDB {
+		f, err = format.V2_0, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot detect the format of the history db, error=[%v]", err)
+	}
+	r := &VerifyReport{Channel: channel}
+	if r.SavePoint, err = readSavePoint(db, channel, f); err != nil {
+		return nil, err
+	}
+
+	hasBlocks := false
+	err = store.Ledger().WalkBlocks(channel, func(b block.Block) error {
+		blockNum := b.GetBlock().GetHeader().GetNumber()
+		if !hasBlocks {
+			r.FirstBlock = blockNum
+		}
+		r.LastBlock, hasBlocks = blockNum, true
+		cb := b.GetBlock()
+		for txNum := range cb.GetData().GetData() {
+			// an invalid transaction is never decoded, its payload may be garbage
+			if block.GetValidationCode(cb, txNum) != peer.TxValidationCode_VALID {
+				continue
+			}
+			tx, err := block.GetTransaction(cb, txNum)
+			if err != nil {
+				return err
+			}
+			if tx.Type != common.HeaderType_ENDORSER_TRANSACTION || tx.RWSet == nil {
+				continue
+			}
+			for _, nsRwSet := range tx.RWSet.NsRwSets {
+				if nsRwSet.KvRwSet == nil {
+					continue
+				}
+				for _, w := range nsRwSet.KvRwSet.Writes {
+					if r.SavePoint == nil || blockNum > r.SavePoint.BlockNum {
+						r.Pending++
+						continue
+					}
+					_, err := db.Get(encodeKey(f, channel, nsRwSet.NameSpace, w.Key, tx.BlockNum, tx.TxNum), nil)
+					if err == leveldb.ErrNotFound {
+						r.Gaps = append(r.Gaps, Issue{
+							Namespace: nsRwSet.NameSpace, Key: w.Key, BlockNum: tx.BlockNum, TxNum: tx.TxNum, TxID: tx.TxID,
+							Detail: "valid write without history entry",
+						})
+						continue
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	iter := db.NewIterator(lutil.BytesPrefix([]byte(channel+"\x00")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return nil, err
+		}
+		general, ok := kv.(*GeneralKV)
+		if !ok {
+			continue
+		}
+		r.Entries++
+		hk, err := general.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if !hasBlocks || hk.BlockNum < r.FirstBlock || hk.BlockNum > r.LastBlock {
+			r.Extras = append(r.Extras, Issue{Namespace: hk.Namespace, Key: hk.Key, BlockNum: hk.BlockNum, TxNum: hk.TxNum, Detail: "block not in the blockfiles"})
+			continue
+		}
+		issue, err := verifyEntry(store, hk)
+		if err != nil {
+			return nil, err
+		}
+		if issue != nil {
+			r.Extras = append(r.Extras, *issue)
+			continue
+		}
+		r.Verified++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// verifyEntry resolves the block of a history entry through the block index and explains why
+// its transaction does not back the entry, nil if it does. The validation code is read from the
+// filter of the block first, an invalid transaction is never decoded.
+func verifyEntry(store *index.BlockStore, hk *HistoryKey) (*Issue, error) {
+	i := &Issue{Namespace: hk.Namespace, Key: hk.Key, BlockNum: hk.BlockNum, TxNum: hk.TxNum}
+	b, err := store.RetrieveBlockByNumber(hk.Channel, hk.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	cb := b.GetBlock()
+	if hk.TxNum >= uint64(len(cb.GetData().GetData())) {
+		i.Detail = "no such transaction in the block"
+		return i, nil
+	}
+	if code := block.GetValidationCode(cb, int(hk.TxNum)); code != peer.TxValidationCode_VALID {
+		i.Detail = fmt.Sprintf("transaction is invalid (%s)", code)
+		return i, nil
+	}
+	tx, err := block.GetTransaction(cb, int(hk.TxNum))
+	if err != nil {
+		return nil, err
+	}
+	i.TxID = tx.TxID
+	switch {
+	case tx.Type != common.HeaderType_ENDORSER_TRANSACTION:
+		i.Detail = fmt.Sprintf("transaction of type %s has no write set", tx.Type)
+	case findWrite(tx, hk.Namespace, hk.Key) == nil:
+		i.Detail = "transaction does not write the key"
+	default:
+		return nil, nil
+	}
+	return i, nil
+}
+
+// findWrite returns the write of a public key by a transaction, nil if it does not write the key
+func findWrite(tx *block.Transaction, ns, key string) *kvrwset.KVWrite {
+	if tx.RWSet == nil {
+		return nil
+	}
+	var write *kvrwset.KVWrite
+	for _, nsRwSet := range tx.RWSet.NsRwSets {
+		if nsRwSet.NameSpace != ns || nsRwSet.KvRwSet == nil {
+			continue
+		}
+		for _, w := range nsRwSet.KvRwSet.Writes {
+			if w.Key == key {
+				write = w
+			}
+		}
+	}
+	return write
+}
+
+// encodeKey encodes a history entry in the data format of the db
+func encodeKey(f format.Version, channel, ns, key string, blockNum, txNum uint64) []byte {
+	if f == format.V1_4 {
+		k := []byte(channel + "\x00" + ns + "\x00" + key + "\x00")
+		return append(k, version.NewHeight(blockNum, txNum).ToBytes()...)
+	}
+	return DataKey(channel, ns, key, blockNum, txNum)
+}
+
+// readSavePoint returns the savepoint of a channel, nil if the db holds no history for it
+func readSavePoint(db *leveldb.DB, channel string, f format.Version) (*version.Height, error) {
+	key := savePointKey(channel)
+	if f == format.V1_4 {
+		key = []byte(channel + "\x00\x00")
+	}
+	value, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := version.NewHeightFromBytes(value)
+	return h, err
+}
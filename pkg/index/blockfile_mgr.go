@@ -68,3 +68,23 @@ func (i *BlockfilesInfo) String() string {
 	return fmt.Sprintf("latestFileNumber=[%d], latestFileSize=[%d], noBlockFiles=[%t], lastPersistedBlock=[%d]",
 		i.latestFileNumber, i.latestFileSize, i.noBlockFiles, i.lastPersistedBlock)
 }
+
+// LatestFileNumber returns the suffix number of the blockfile currently being written
+func (i *BlockfilesInfo) LatestFileNumber() int {
+	return i.latestFileNumber
+}
+
+// LatestFileSize returns the number of bytes written to the latest blockfile
+func (i *BlockfilesInfo) LatestFileSize() int {
+	return i.latestFileSize
+}
+
+// NoBlockFiles reports whether no block has been written yet
+func (i *BlockfilesInfo) NoBlockFiles() bool {
+	return i.noBlockFiles
+}
+
+// LastPersistedBlock returns the number of the last block written to the blockfiles
+func (i *BlockfilesInfo) LastPersistedBlock() uint64 {
+	return i.lastPersistedBlock
+}
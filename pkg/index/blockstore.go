@@ -0,0 +1,397 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/common/ledger/blkstorage/fsblkstorage/msgs"
+	"github.com/hyperledger/fabric/common/ledger/util"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+var ErrNotFoundInIndex = errors.New("entry not found in index")
+
+const (
+	blockNumIdxKeyPrefix         = 'n'
+	blockHashIdxKeyPrefix        = 'h'
+	txIDIdxKeyPrefix             = 't'
+	blockNumTranNumIdxKeyPrefix  = 'a'
+	txValidationCodeIdxKeyPrefix = 'v' // v1.x
+	indexCheckpointKeyStr        = "indexCheckpointKey"
+	blkMgrInfoKeyStr             = "blkMgrInfo"
+
+	bootstrappingSnapshotInfoKeyStr = "bootstrappingSnapshotInfo"
+)
+
+// BlockStore retrieves blocks and transactions of a peer or orderer ledger through the block index
+type BlockStore struct {
+	ledger *block.Ledger
+	db     *leveldb.DB
+	format format.Version
+}
+
+// OpenBlockStore opens the block index below a peer or orderer production directory read-only
+func OpenBlockStore(productionDir string) (*BlockStore, error) {
+	ledger, err := block.OpenLedger(productionDir)
+	if err != nil {
+		return nil, err
+	}
+	opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+	db, err := leveldb.OpenFile(ledger.IndexDir, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot open index: [%s], error=[%v]", ledger.IndexDir, err)
+	}
+	store, err := NewBlockStore(ledger, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewBlockStore returns a BlockStore on an already opened index.
+// An empty index holds nothing to misread and is read as 2.0.
+func NewBlockStore(ledger *block.Ledger, db *leveldb.DB) (*BlockStore, error) {
+	f, err := format.Detect(db)
+	if err == format.ErrEmptyDB {
+		f, err = format.V2_0, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot detect the format of the index, error=[%v]", err)
+	}
+	return &BlockStore{ledger: ledger, db: db, format: f}, nil
+}
+
+// Format returns the data format of the index
+func (s *BlockStore) Format() format.Version {
+	return s.format
+}
+
+// Close closes the index
+func (s *BlockStore) Close() error {
+	return s.db.Close()
+}
+
+// Ledger returns the ledger layout the store reads from
+func (s *BlockStore) Ledger() *block.Ledger {
+	return s.ledger
+}
+
+func channelKey(channel string, key []byte) []byte {
+	return append(append([]byte(channel), 0x00), key...)
+}
+
+func constructBlockNumKey(channel string, blockNum uint64) []byte {
+	return channelKey(channel, append([]byte{blockNumIdxKeyPrefix}, util.EncodeOrderPreservingVarUint64(blockNum)...))
+}
+
+func constructBlockNumTranNumKey(channel string, blockNum, txNum uint64) []byte {
+	key := append([]byte{blockNumTranNumIdxKeyPrefix}, util.EncodeOrderPreservingVarUint64(blockNum)...)
+	return channelKey(channel, append(key, util.EncodeOrderPreservingVarUint64(txNum)...))
+}
+
+func constructTxIDKeyPrefix(channel string, txID string, f format.Version) []byte {
+	if f == format.V1_4 {
+		return channelKey(channel, append([]byte{txIDIdxKeyPrefix}, txID...))
+	}
+	key := append([]byte{txIDIdxKeyPrefix}, util.EncodeOrderPreservingVarUint64(uint64(len(txID)))...)
+	return channelKey(channel, append(key, txID...))
+}
+
+func (s *BlockStore) get(key []byte) ([]byte, error) {
+	value, err := s.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFoundInIndex
+	}
+	return value, err
+}
+
+// BlockfilesInfo returns the summary about the blockfiles of a channel
+func (s *BlockStore) BlockfilesInfo(channel string) (*BlockfilesInfo, error) {
+	value, err := s.get(channelKey(channel, []byte(blkMgrInfoKeyStr)))
+	if err != nil {
+		return nil, err
+	}
+	info := &BlockfilesInfo{}
+	if err := info.Unmarshal(value); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// LastBlockIndexed returns the number of the last block recorded in the index checkpoint of a channel
+func (s *BlockStore) LastBlockIndexed(channel string) (uint64, error) {
+	value, err := s.get(channelKey(channel, []byte(indexCheckpointKeyStr)))
+	if err != nil {
+		return 0, err
+	}
+	blockNum, n := proto.DecodeVarint(value)
+	if n == 0 {
+		return 0, fmt.Errorf("invalid index checkpoint [%x]", value)
+	}
+	return blockNum, nil
+}
+
+// BlockLocation returns where the block is stored in the blockfiles
+func (s *BlockStore) BlockLocation(channel string, blockNum uint64) (*FileLocPointer, error) {
+	value, err := s.get(constructBlockNumKey(channel, blockNum))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "block [%d] of channel [%s]", blockNum, channel)
+	}
+	flp := &FileLocPointer{}
+	if err := flp.unmarshal(value); err != nil {
+		return nil, err
+	}
+	return flp, nil
+}
+
+// RetrieveBlockByNumber reads a single block from the blockfiles
+func (s *BlockStore) RetrieveBlockByNumber(channel string, blockNum uint64) (block.Block, error) {
+	flp, err := s.BlockLocation(channel, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(block.BlockFilePath(s.ledger.ChannelDir(channel), flp.FileSuffixNum))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	blockBytes, err := block.ReadBlock(file, int64(flp.Offset))
+	if err != nil {
+		return nil, err
+	}
+	if blockBytes == nil {
+		return nil, fmt.Errorf("block [%d] is beyond the end of blockfile [%d]", blockNum, flp.FileSuffixNum)
+	}
+	b, err := block.DeserializeBlock(blockBytes)
+	if err != nil {
+		return nil, err
+	}
+	if b.Header.Number != blockNum {
+		return nil, fmt.Errorf("index points to block [%d] while block [%d] was requested", b.Header.Number, blockNum)
+	}
+	if protoutil.IsConfigBlock(b) {
+		return &block.ConfigBlock{Block: b}, nil
+	}
+	return &block.StandardBlock{Block: b}, nil
+}
+
+// RetrieveTxByBlockNumTranNum returns the transaction envelope at the given height.
+// Orderers do not index transactions, so for them the whole block is read.
+func (s *BlockStore) RetrieveTxByBlockNumTranNum(channel string, blockNum, txNum uint64) (*common.Envelope, error) {
+	value, err := s.get(constructBlockNumTranNumKey(channel, blockNum, txNum))
+	if err == ErrNotFoundInIndex {
+		return s.retrieveTxFromBlock(channel, blockNum, txNum)
+	}
+	if err != nil {
+		return nil, err
+	}
+	txFlp := &FileLocPointer{}
+	if err := txFlp.unmarshal(value); err != nil {
+		return nil, err
+	}
+	return s.readTransaction(channel, txFlp)
+}
+
+// RetrieveTxByID returns the transaction envelope with the given transaction id
+func (s *BlockStore) RetrieveTxByID(channel string, txID string) (*common.Envelope, error) {
+	if s.format == format.V1_4 {
+		// 1.x keys end with the transaction id, so it is an exact lookup
+		value, err := s.get(constructTxIDKeyPrefix(channel, txID, s.format))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "transaction [%s] of channel [%s]", txID, channel)
+		}
+		txFlp := &FileLocPointer{}
+		if err := txFlp.unmarshal(value); err != nil {
+			return nil, err
+		}
+		return s.readTransaction(channel, txFlp)
+	}
+	iter := s.db.NewIterator(lutil.BytesPrefix(constructTxIDKeyPrefix(channel, txID, s.format)), nil)
+	defer iter.Release()
+	if !iter.Next() {
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		return nil, errors.WithMessagef(ErrNotFoundInIndex, "transaction [%s] of channel [%s]", txID, channel)
+	}
+	value, err := IdxTxID{iter.Key(), iter.Value(), format.V2_0}.Value()
+	if err != nil {
+		return nil, err
+	}
+	return s.readTransaction(channel, value.txFlp)
+}
+
+// RetrieveTxValidationCode returns the validation code of the transaction txID at the given height.
+// It is read from the transaction id index, or from the block when the index holds no entry.
+func (s *BlockStore) RetrieveTxValidationCode(channel, txID string, blockNum, txNum uint64) (peer.TxValidationCode, error) {
+	if s.format == format.V1_4 {
+		value, err := s.get(channelKey(channel, append([]byte{txValidationCodeIdxKeyPrefix}, txID...)))
+		if err == nil && len(value) == 1 {
+			return peer.TxValidationCode(value[0]), nil
+		}
+		if err != nil && err != ErrNotFoundInIndex {
+			return 0, err
+		}
+	} else {
+		key := constructTxIDKeyPrefix(channel, txID, s.format)
+		key = append(key, util.EncodeOrderPreservingVarUint64(blockNum)...)
+		key = append(key, util.EncodeOrderPreservingVarUint64(txNum)...)
+		value, err := s.get(key)
+		if err == nil {
+			txIdxValue := &msgs.TxIDIndexValProto{}
+			if err := proto.Unmarshal(value, txIdxValue); err != nil {
+				return 0, err
+			}
+			return peer.TxValidationCode(txIdxValue.TxValidationCode), nil
+		}
+		if err != ErrNotFoundInIndex {
+			return 0, err
+		}
+	}
+
+	b, err := s.RetrieveBlockByNumber(channel, blockNum)
+	if err != nil {
+		return 0, err
+	}
+	filter := b.GetTxFilters()
+	if txNum >= uint64(len(b.GetBlock().GetData().GetData())) {
+		return 0, errors.WithMessagef(ErrNotFoundInIndex, "block [%d] has no transaction [%d]", blockNum, txNum)
+	}
+	if txNum >= uint64(len(filter)) {
+		return peer.TxValidationCode_NOT_VALIDATED, nil
+	}
+	return peer.TxValidationCode(filter[txNum]), nil
+}
+
+// LatestConfigBlock returns the last config block of a channel, located through the
+// last config index the orderer records in the metadata of the last block
+func (s *BlockStore) LatestConfigBlock(channel string) (*common.Block, error) {
+	last, err := s.LastBlockIndexed(channel)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "last block of channel [%s]", channel)
+	}
+	lastBlock, err := s.RetrieveBlockByNumber(channel, last)
+	if err != nil {
+		return nil, err
+	}
+	configNum, err := protoutil.GetLastConfigIndexFromBlock(lastBlock.GetBlock())
+	if err != nil {
+		return nil, errors.WithMessagef(err, "cannot read the last config index of block [%d]", last)
+	}
+	configBlock, err := s.RetrieveBlockByNumber(channel, configNum)
+	if err != nil {
+		return nil, err
+	}
+	if !configBlock.IsConfig() {
+		return nil, fmt.Errorf("error: block [%d] referenced as last config by block [%d] is not a config block", configNum, last)
+	}
+	return configBlock.GetBlock(), nil
+}
+
+func (s *BlockStore) retrieveTxFromBlock(channel string, blockNum, txNum uint64) (*common.Envelope, error) {
+	b, err := s.RetrieveBlockByNumber(channel, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	data := b.GetBlock().GetData().GetData()
+	if txNum >= uint64(len(data)) {
+		return nil, errors.WithMessagef(ErrNotFoundInIndex, "block [%d] has no transaction [%d]", blockNum, txNum)
+	}
+	return protoutil.GetEnvelopeFromBlock(data[txNum])
+}
+
+func (s *BlockStore) readTransaction(channel string, txFlp *FileLocPointer) (*common.Envelope, error) {
+	file, err := os.Open(block.BlockFilePath(s.ledger.ChannelDir(channel), txFlp.FileSuffixNum))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	txBytes, err := block.ReadTransaction(file, int64(txFlp.Offset), int64(txFlp.BytesLength))
+	if err != nil {
+		return nil, err
+	}
+	if txBytes == nil {
+		return nil, fmt.Errorf("transaction location is beyond the end of blockfile [%d]", txFlp.FileSuffixNum)
+	}
+	// the location covers the length prefix of the envelope bytes
+	_, n := proto.DecodeVarint(txBytes)
+	if n == 0 {
+		return nil, fmt.Errorf("Error in decoding varint bytes [%#v]", txBytes)
+	}
+	return protoutil.GetEnvelopeFromBlock(txBytes[n:])
+}
+
+// FirstBlock returns the number of the first block in the blockfiles of a channel, which follows
+// the last block of the snapshot a v2.3+ ledger was bootstrapped from and is 0 otherwise
+func (s *BlockStore) FirstBlock(channel string) (uint64, error) {
+	value, err := s.get(channelKey(channel, []byte(bootstrappingSnapshotInfoKeyStr)))
+	if err == ErrNotFoundInIndex {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	lastBlockNum, err := IdxBootstrappingSnapshotInfo{value: value}.LastBlockNum()
+	if err != nil {
+		return 0, err
+	}
+	return lastBlockNum + 1, nil
+}
+
+// FindBlockByTime returns the number of the first block created at or after t.
+// The creation time of a block is the timestamp in the channel header of its first
+// transaction. Each probe of the binary search reads a single block through the block
+// number index, so the search works without the transaction indexes. As the timestamps
+// are set by clients, they are assumed to grow with the block number.
+func (s *BlockStore) FindBlockByTime(channel string, t time.Time) (uint64, error) {
+	last, err := s.LastBlockIndexed(channel)
+	if err != nil {
+		return 0, err
+	}
+	first, err := s.FirstBlock(channel)
+	if err != nil {
+		return 0, err
+	}
+	lo, hi := first, last+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		blockTime, err := s.blockTime(channel, mid)
+		if err != nil {
+			return 0, err
+		}
+		if blockTime.Before(t) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo > last {
+		return 0, errors.WithMessagef(ErrNotFoundInIndex, "no block of channel [%s] at or after [%s]", channel, t.Format(time.RFC3339))
+	}
+	return lo, nil
+}
+
+func (s *BlockStore) blockTime(channel string, blockNum uint64) (time.Time, error) {
+	b, err := s.RetrieveBlockByNumber(channel, blockNum)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tx, err := block.GetTransactionHeader(b.GetBlock(), 0)
+	if err != nil {
+		return time.Time{}, errors.WithMessagef(err, "cannot read the creation time of block [%d]", blockNum)
+	}
+	return tx.Timestamp, nil
+}
@@ -3,9 +3,17 @@ package index
 import (
 	"bytes"
 	"fmt"
+
+	"github.com/the-medium/ledger-parser/pkg/format"
 )
 
 func ParseKV(key []byte, value []byte, channel string) (idxKV IndexKV, err error) {
+	return ParseKVWithFormat(key, value, channel, format.V2_0)
+}
+
+// ParseKVWithFormat is ParseKV for an index written in the given data format.
+// 1.x indexes store a bare location for 't' and additionally have 'b' and 'v' entries.
+func ParseKVWithFormat(key []byte, value []byte, channel string, f format.Version) (idxKV IndexKV, err error) {
 	keys := bytes.SplitN(key, []byte{0x00}, 2)
 	if string(keys[0]) != channel && channel != "" {
 		return nil, nil
@@ -19,15 +27,24 @@ func ParseKV(key []byte, value []byte, channel string) (idxKV IndexKV, err error
 	case byte(0x68): // 'h' : blockHashIdxKeyPrefix
 		idxKV = &IdxBlockHash{key, value}
 	case byte(0x74): // 't' : txIDIdxKeyPrefix
-		idxKV = &IdxTxID{key, value}
+		idxKV = &IdxTxID{key, value, f}
 	case byte(0x61): // 'a' : blockNumTranNumIdxKeyPrefix
 		idxKV = &IdxBlockNumTxNum{key, value}
 	case byte(0x62): // 'b' : blockTxIDIdxKeyPrefix
 		if bytes.Equal(keys[1], []byte("blkMgrInfo")) { // indexCheckpointKey
 			idxKV = &IdxBlkMgrInfo{key, value}
+		} else if bytes.Equal(keys[1], []byte(bootstrappingSnapshotInfoKeyStr)) { // v2.3+
+			idxKV = &IdxBootstrappingSnapshotInfo{key, value}
+		} else if f == format.V1_4 {
+			idxKV = &IdxBlockTxID{key, value}
 		} else {
 			return nil, fmt.Errorf("unknown prefix starting with 'b'")
 		}
+	case byte(0x76): // 'v' : txValidationCodeIdxKeyPrefix (v1.x)
+		if f != format.V1_4 {
+			return nil, fmt.Errorf("unknown prefix")
+		}
+		idxKV = &IdxTxValidationCode{key, value}
 	case byte(0x66):
 		idxKV = &IdxFormatKey{key, value}
 	default:
@@ -1,11 +1,24 @@
 package index
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/the-medium/ledger-parser/internal/testutil"
 )
 
 func TestParseKV(t *testing.T) {
@@ -29,3 +42,183 @@ func TestParseKV(t *testing.T) {
 	err = iter.Error()
 	assert.NoError(t, err)
 }
+
+func newTestLedger(t *testing.T, root string, orderer bool) []*common.Block {
+	ts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	invoke := func(txID string) *testutil.Tx {
+		return &testutil.Tx{
+			TxID: txID, ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION,
+			Timestamp: ts, MSPID: "Org1MSP", Chaincode: "mycc", Args: [][]byte{[]byte("put")},
+			RWSet: &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{
+				{NameSpace: "mycc", KvRwSet: &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: txID, Value: []byte(txID)}}}},
+			}},
+		}
+	}
+	blocks, err := testutil.NewChain(!orderer,
+		[]*testutil.Tx{{TxID: "genesis", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts}},
+		[]*testutil.Tx{invoke("tx1"), invoke("tx2")},
+		[]*testutil.Tx{invoke("tx3")},
+	)
+	assert.NoError(t, err)
+
+	base := filepath.Join(root, "ledgersData", "chains")
+	chainsDir, indexDir := filepath.Join(base, "chains"), filepath.Join(base, "index")
+	if orderer {
+		base = filepath.Join(root, "orderer")
+		chainsDir, indexDir = filepath.Join(base, "chains"), filepath.Join(base, "index")
+	}
+	assert.NoError(t, testutil.WriteLedger(chainsDir, indexDir, "mychannel", !orderer, blocks...))
+	return blocks
+}
+
+func TestBlockStore(t *testing.T) {
+	for _, orderer := range []bool{false, true} {
+		root, err := ioutil.TempDir("", "blockstore")
+		assert.NoError(t, err)
+		defer os.RemoveAll(root)
+		blocks := newTestLedger(t, root, orderer)
+
+		store, err := OpenBlockStore(root)
+		assert.NoError(t, err)
+		defer store.Close()
+		assert.Equal(t, orderer, store.Ledger().IsOrderer())
+
+		channels, err := store.Ledger().Channels()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"mychannel"}, channels)
+
+		last, err := store.LastBlockIndexed("mychannel")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), last)
+		info, err := store.BlockfilesInfo("mychannel")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), info.LastPersistedBlock())
+
+		b, err := store.RetrieveBlockByNumber("mychannel", 0)
+		assert.NoError(t, err)
+		assert.True(t, b.IsConfig())
+
+		b, err = store.RetrieveBlockByNumber("mychannel", 1)
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(blocks[1], b.GetBlock()))
+
+		// orderer blocks carry no TRANSACTIONS_FILTER
+		envs, err := b.GetTransactionEnvelops()
+		assert.NoError(t, err)
+		rwsets, err := b.GetTxRWSets(envs)
+		assert.NoError(t, err)
+		assert.Len(t, rwsets, 2)
+
+		env, err := store.RetrieveTxByBlockNumTranNum("mychannel", 1, 1)
+		assert.NoError(t, err)
+		chdr, err := protoutil.ChannelHeader(env)
+		assert.NoError(t, err)
+		assert.Equal(t, "tx2", chdr.TxId)
+
+		// orderers do not validate, their blocks are read for the missing filter
+		code, err := store.RetrieveTxValidationCode("mychannel", "tx2", 1, 1)
+		assert.NoError(t, err)
+		if orderer {
+			assert.Equal(t, peer.TxValidationCode_NOT_VALIDATED, code)
+		} else {
+			assert.Equal(t, peer.TxValidationCode_VALID, code)
+		}
+		_, err = store.RetrieveTxValidationCode("mychannel", "tx9", 1, 9)
+		assert.True(t, errors.Is(err, ErrNotFoundInIndex))
+
+		configBlock, err := store.LatestConfigBlock("mychannel")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), configBlock.Header.Number)
+
+		_, err = store.RetrieveBlockByNumber("mychannel", 3)
+		assert.Error(t, err)
+
+		if orderer {
+			continue
+		}
+		env, err = store.RetrieveTxByID("mychannel", "tx3")
+		assert.NoError(t, err)
+		chdr, err = protoutil.ChannelHeader(env)
+		assert.NoError(t, err)
+		assert.Equal(t, "tx3", chdr.TxId)
+	}
+}
+
+func TestFindBlockByTime(t *testing.T) {
+	root, err := ioutil.TempDir("", "blockstore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	day := time.Date(2026, 2, 26, 12, 0, 0, 0, time.UTC)
+	var txsPerBlock [][]*testutil.Tx
+	for i := 0; i < 6; i++ {
+		ts := day.Add(time.Duration(i) * 24 * time.Hour)
+		txsPerBlock = append(txsPerBlock, []*testutil.Tx{
+			{TxID: fmt.Sprintf("tx%d", i), ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts, MSPID: "Org1MSP", Chaincode: "mycc"},
+		})
+	}
+	blocks, err := testutil.NewChain(true, txsPerBlock...)
+	assert.NoError(t, err)
+	base := filepath.Join(root, "ledgersData", "chains")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(base, "chains"), filepath.Join(base, "index"), "mychannel", true, blocks...))
+
+	store, err := OpenBlockStore(root)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	for _, tc := range []struct {
+		t        time.Time
+		blockNum uint64
+	}{
+		{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{day, 0},
+		{time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 3},
+		{day.Add(5 * 24 * time.Hour), 5},
+	} {
+		blockNum, err := store.FindBlockByTime("mychannel", tc.t)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.blockNum, blockNum, tc.t.String())
+	}
+
+	_, err = store.FindBlockByTime("mychannel", day.Add(6*24*time.Hour))
+	assert.True(t, errors.Is(err, ErrNotFoundInIndex))
+
+	// the search only needs the block number index
+	blockNumRoot := filepath.Join(root, "blocknum")
+	blockNumBase := filepath.Join(blockNumRoot, "ledgersData", "chains")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(blockNumBase, "chains"), filepath.Join(blockNumBase, "index"), "mychannel", false, blocks...))
+	blockNumStore, err := OpenBlockStore(blockNumRoot)
+	assert.NoError(t, err)
+	defer blockNumStore.Close()
+	blockNum, err := blockNumStore.FindBlockByTime("mychannel", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), blockNum)
+
+	// a ledger bootstrapped from a snapshot of blocks 0-2 starts at block 3
+	snapshotRoot := filepath.Join(root, "snapshot")
+	snapshotBase := filepath.Join(snapshotRoot, "ledgersData", "chains")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(snapshotBase, "chains"), filepath.Join(snapshotBase, "index"), "mychannel", true, blocks[3:]...))
+	db, err := leveldb.OpenFile(filepath.Join(snapshotBase, "index"), nil)
+	assert.NoError(t, err)
+	// BootstrappingSnapshotInfo{LastBlockNum: 2}
+	assert.NoError(t, db.Put(testutil.Key("mychannel", []byte(bootstrappingSnapshotInfoKeyStr)), []byte{0x08, 0x02}, nil))
+	db.Close()
+
+	snapshotStore, err := OpenBlockStore(snapshotRoot)
+	assert.NoError(t, err)
+	defer snapshotStore.Close()
+	first, err := snapshotStore.FirstBlock("mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), first)
+	for _, tc := range []struct {
+		t        time.Time
+		blockNum uint64
+	}{
+		{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 3},
+		{day.Add(4 * 24 * time.Hour), 4},
+	} {
+		blockNum, err := snapshotStore.FindBlockByTime("mychannel", tc.t)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.blockNum, blockNum, tc.t.String())
+	}
+}
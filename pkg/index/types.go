@@ -8,9 +8,11 @@ import (
 
 	"github.com/gogo/protobuf/proto"
 	gproto "github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/common/ledger/blkstorage/fsblkstorage/msgs"
 	"github.com/hyperledger/fabric/common/ledger/util"
 	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/format"
 )
 
 const (
@@ -21,6 +23,9 @@ const (
 	BlkMgrInfo
 	CheckPoint
 	FormatKey
+	BlockTxID
+	TxValidationCode
+	BootstrappingSnapshotInfo
 )
 
 type locPointer struct {
@@ -206,8 +211,9 @@ func (i IdxBlockHash) Type() int {
 
 // IdxTxID is index for searching file, offset and bytesize of Transaction. Prefix: 't'
 type IdxTxID struct {
-	key   []byte
-	value []byte
+	key    []byte
+	value  []byte
+	format format.Version
 }
 
 func (i IdxTxID) Channel() string {
@@ -219,10 +225,21 @@ func (i IdxTxID) Key() []byte {
 }
 
 func (i IdxTxID) Value() (IndexValue, error) {
+	if i.format == format.V1_4 {
+		// v1.x stores the transaction location only
+		txFlp := &FileLocPointer{}
+		if err := txFlp.unmarshal(i.value); err != nil {
+			return IndexValue{}, err
+		}
+		return IndexValue{txFlp: txFlp}, nil
+	}
+
 	// blkstorage.TxIDIndexValue{} and msgs.TxIDIndexValProto{} are same structure
 	// txIdxValue := &index.TxIDIndexValue{} // v2.2.1
 	txIdxValue := &msgs.TxIDIndexValProto{} // v2.1.1
-	gproto.Unmarshal(i.value, txIdxValue)
+	if err := gproto.Unmarshal(i.value, txIdxValue); err != nil {
+		return IndexValue{}, err
+	}
 	blkFlp := &FileLocPointer{}
 	txFlp := &FileLocPointer{}
 
@@ -238,9 +255,18 @@ func (i IdxTxID) Value() (IndexValue, error) {
 	return IndexValue{blkFlp: blkFlp, txFlp: txFlp}, nil
 }
 
+// TxID returns the transaction id of the entry
+func (i IdxTxID) TxID() (string, error) {
+	internalKey := bytes.SplitN(i.key, []byte{0x00}, 2)[1]
+	if i.format == format.V1_4 {
+		return string(internalKey[1:]), nil
+	}
+	return RetrieveTxID(internalKey)
+}
+
 func (i IdxTxID) Print() {
 	channel := i.Channel()
-	key, err := RetrieveTxID(bytes.SplitN(i.key, []byte{0x00}, 2)[1])
+	key, err := i.TxID()
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -415,3 +441,151 @@ func (i IdxFormatKey) Print() {
 func (i IdxFormatKey) Type() int {
 	return FormatKey
 }
+
+// IdxBlockTxID is the v1.x index for searching the block of a transaction id. Prefix: 'b'
+type IdxBlockTxID struct {
+	key   []byte
+	value []byte
+}
+
+func (i IdxBlockTxID) Channel() string {
+	return string(bytes.SplitN(i.key, []byte{0x00}, 2)[0])
+}
+
+func (i IdxBlockTxID) Key() []byte {
+	return i.key
+}
+
+func (i IdxBlockTxID) Value() (IndexValue, error) {
+	blkFlp := &FileLocPointer{}
+	err := blkFlp.unmarshal(i.value)
+	if err != nil {
+		return IndexValue{}, err
+	}
+	return IndexValue{blkFlp: blkFlp}, nil
+}
+
+func (i IdxBlockTxID) Print() {
+	channel := i.Channel()
+	key := bytes.SplitN(i.key, []byte{0x00}, 2)[1][1:]
+	value, err := i.Value()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("[IdxBlockTxID][%s] key:  %s, value: %s\n", channel, key, value.String())
+}
+
+func (i IdxBlockTxID) Type() int {
+	return BlockTxID
+}
+
+// IdxTxValidationCode is the v1.x index for the validation code of a transaction id. Prefix: 'v'
+type IdxTxValidationCode struct {
+	key   []byte
+	value []byte
+}
+
+func (i IdxTxValidationCode) Channel() string {
+	return string(bytes.SplitN(i.key, []byte{0x00}, 2)[0])
+}
+
+func (i IdxTxValidationCode) Key() []byte {
+	return i.key
+}
+
+func (i IdxTxValidationCode) Value() (IndexValue, error) {
+	if len(i.value) != 1 {
+		return IndexValue{}, fmt.Errorf("invalid validation code [%x]", i.value)
+	}
+	return IndexValue{value: peer.TxValidationCode(i.value[0]).String()}, nil
+}
+
+func (i IdxTxValidationCode) Print() {
+	channel := i.Channel()
+	key := bytes.SplitN(i.key, []byte{0x00}, 2)[1][1:]
+	value, err := i.Value()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("[IdxTxValidationCode][%s] key:  %s, value: %s\n", channel, key, value.String())
+}
+
+func (i IdxTxValidationCode) Type() int {
+	return TxValidationCode
+}
+
+// IdxBootstrappingSnapshotInfo records the snapshot a v2.3+ ledger was bootstrapped from
+type IdxBootstrappingSnapshotInfo struct {
+	key   []byte
+	value []byte
+}
+
+func (i IdxBootstrappingSnapshotInfo) Channel() string {
+	return string(bytes.SplitN(i.key, []byte{0x00}, 2)[0])
+}
+
+func (i IdxBootstrappingSnapshotInfo) Key() []byte {
+	return i.key
+}
+
+// Value decodes the BootstrappingSnapshotInfo message
+func (i IdxBootstrappingSnapshotInfo) Value() (IndexValue, error) {
+	lastBlockNum, lastBlockHash, previousBlockHash, err := i.decode()
+	if err != nil {
+		return IndexValue{}, err
+	}
+	return IndexValue{value: fmt.Sprintf("lastBlockNum: %d, lastBlockHash: %x, previousBlockHash: %x", lastBlockNum, lastBlockHash, previousBlockHash)}, nil
+}
+
+// LastBlockNum returns the number of the last block contained in the snapshot
+func (i IdxBootstrappingSnapshotInfo) LastBlockNum() (uint64, error) {
+	lastBlockNum, _, _, err := i.decode()
+	return lastBlockNum, err
+}
+
+// decode reads the BootstrappingSnapshotInfo message
+// (1: lastBlockNum, 2: lastBlockHash, 3: previousBlockHash) field by field.
+func (i IdxBootstrappingSnapshotInfo) decode() (uint64, []byte, []byte, error) {
+	buffer := utils.NewBuffer(i.value)
+	var lastBlockNum uint64
+	var lastBlockHash, previousBlockHash []byte
+	for buffer.GetBytesConsumed() < len(i.value) {
+		tag, err := buffer.DecodeVarint()
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		switch tag {
+		case 1<<3 | proto.WireVarint:
+			lastBlockNum, err = buffer.DecodeVarint()
+		case 2<<3 | proto.WireBytes:
+			lastBlockHash, err = buffer.DecodeRawBytes(true)
+		case 3<<3 | proto.WireBytes:
+			previousBlockHash, err = buffer.DecodeRawBytes(true)
+		default:
+			err = fmt.Errorf("unexpected field tag [%d]", tag)
+		}
+		if err != nil {
+			return 0, nil, nil, err
+		}
+	}
+	return lastBlockNum, lastBlockHash, previousBlockHash, nil
+}
+
+func (i IdxBootstrappingSnapshotInfo) Print() {
+	channel := i.Channel()
+	value, err := i.Value()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("[IdxBootstrappingSnapshotInfo][%s] key:  %s, value: %s\n", channel, bootstrappingSnapshotInfoKeyStr, value.String())
+}
+
+func (i IdxBootstrappingSnapshotInfo) Type() int {
+	return BootstrappingSnapshotInfo
+}
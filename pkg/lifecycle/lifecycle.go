@@ -0,0 +1,356 @@
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	lb "github.com/hyperledger/fabric-protos-go/peer/lifecycle"
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/policy"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+const (
+	// Namespace is the namespace of the lifecycle system chaincode
+	Namespace = "_lifecycle"
+
+	// ImplicitCollectionPrefix prefixes the private collection of each org, <prefix><MSPID>
+	ImplicitCollectionPrefix = "_implicit_org_"
+
+	namespacesSpace = "namespaces"
+	sourcesSpace    = "chaincode-sources"
+)
+
+// parameterFields are the fields of a ChaincodeParameters approval, in the order the serializer writes them
+var parameterFields = []string{"EndorsementInfo", "ValidationInfo", "Collections"}
+
+// Definition is a chaincode definition, committed or approved by an org
+type Definition struct {
+	Name              string       `json:"name"`
+	Sequence          int64        `json:"sequence"`
+	Version           string       `json:"version"`
+	InitRequired      bool         `json:"init_required"`
+	EndorsementPlugin string       `json:"endorsement_plugin"`
+	ValidationPlugin  string       `json:"validation_plugin"`
+	EndorsementPolicy string       `json:"endorsement_policy"`
+	Collections       []Collection `json:"collections,omitempty"`
+
+	// fields keeps the serialized parameter fields, approvals are matched against their hashes
+	fields map[string][]byte
+}
+
+// Collection is the static config of a private data collection of a definition
+type Collection struct {
+	Name              string `json:"name"`
+	MemberOrgsPolicy  string `json:"member_orgs_policy"`
+	RequiredPeerCount int32  `json:"required_peer_count"`
+	MaximumPeerCount  int32  `json:"maximum_peer_count"`
+	BlockToLive       uint64 `json:"block_to_live"`
+	MemberOnlyRead    bool   `json:"member_only_read"`
+	MemberOnlyWrite   bool   `json:"member_only_write"`
+	EndorsementPolicy string `json:"endorsement_policy,omitempty"`
+}
+
+// Approval is the approval of a definition by an org
+type Approval struct {
+	MSPID    string `json:"mspid"`
+	Approved bool   `json:"approved"`
+	// MatchesCommitted reports whether the approved parameters equal those of the committed definition
+	MatchesCommitted bool `json:"matches_committed"`
+	// Definition is the approved definition, only known on the peers of the org itself
+	Definition *Definition `json:"definition,omitempty"`
+}
+
+// Lifecycle is the _lifecycle state of a channel
+type Lifecycle struct {
+	Channel     string
+	definitions map[string]*Definition            // committed, by chaincode name
+	approved    map[string]map[string]*Definition // cleartext approvals, by org and <name>#<sequence>
+	hashes      map[string]map[string][]byte      // hashes of the org collections, by org and key hash
+	sources     map[string]map[string]string      // cleartext package ids, by org and <name>#<sequence>
+}
+
+// Load reads the _lifecycle namespace of a channel from a stateLeveldb
+func Load(db *leveldb.DB, channel string) (*Lifecycle, error) {
+	f, err := format.Detect(db)
+	if err != nil {
+		return nil, err
+	}
+	if f == format.V1_4 {
+		return nil, fmt.Errorf("the state db of format %s has no %s namespace", f, Namespace)
+	}
+	l := &Lifecycle{
+		Channel:     channel,
+		definitions: map[string]*Definition{},
+		approved:    map[string]map[string]*Definition{},
+		hashes:      map[string]map[string][]byte{},
+		sources:     map[string]map[string]string{},
+	}
+	committed := map[string]map[string]*state.LifecycleField{}
+	approved := map[string]map[string]map[string]*state.LifecycleField{}
+	raw := map[string]map[string][]byte{}
+
+	iter := db.NewIterator(lutil.BytesPrefix([]byte(channel+"\x00d"+Namespace)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := state.ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return nil, err
+		}
+		if kv == nil {
+			continue
+		}
+		record, err := kv.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if record.Namespace != Namespace {
+			continue
+		}
+		switch {
+		case record.Collection == "":
+			field := record.Lifecycle
+			if field == nil || field.Space != namespacesSpace {
+				continue
+			}
+			if committed[field.Name] == nil {
+				committed[field.Name] = map[string]*state.LifecycleField{}
+				raw[field.Name] = map[string][]byte{}
+			}
+			committed[field.Name][field.Field] = field
+			raw[field.Name][field.Field] = record.Value
+		case !strings.HasPrefix(record.Collection, ImplicitCollectionPrefix):
+			continue
+		case record.Hashed:
+			org := strings.TrimPrefix(record.Collection, ImplicitCollectionPrefix)
+			if l.hashes[org] == nil {
+				l.hashes[org] = map[string][]byte{}
+			}
+			l.hashes[org][record.Key] = record.Value
+		default:
+			field := record.Lifecycle
+			org := strings.TrimPrefix(record.Collection, ImplicitCollectionPrefix)
+			if field != nil && field.Space == sourcesSpace && field.Field == "PackageID" {
+				if l.sources[org] == nil {
+					l.sources[org] = map[string]string{}
+				}
+				l.sources[org][field.Name], _ = field.Value.(string)
+				continue
+			}
+			if field == nil || field.Space != namespacesSpace {
+				continue
+			}
+			if approved[org] == nil {
+				approved[org] = map[string]map[string]*state.LifecycleField{}
+			}
+			if approved[org][field.Name] == nil {
+				approved[org][field.Name] = map[string]*state.LifecycleField{}
+			}
+			approved[org][field.Name][field.Field] = field
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	for name, fields := range committed {
+		// the metadata entry (empty field) marks a definition, it is removed with the namespace
+		if fields[""] == nil {
+			continue
+		}
+		def, err := newDefinition(name, fields)
+		if err != nil {
+			return nil, err
+		}
+		def.fields = raw[name]
+		l.definitions[name] = def
+	}
+	for org, byName := range approved {
+		l.approved[org] = map[string]*Definition{}
+		for nameSeq, fields := range byName {
+			name, seq, err := splitNameSequence(nameSeq)
+			if err != nil {
+				return nil, err
+			}
+			def, err := newDefinition(name, fields)
+			if err != nil {
+				return nil, err
+			}
+			def.Sequence = seq
+			l.approved[org][nameSeq] = def
+		}
+	}
+	return l, nil
+}
+
+// newDefinition assembles the decoded fields of a definition
+func newDefinition(name string, fields map[string]*state.LifecycleField) (*Definition, error) {
+	def := &Definition{Name: name}
+	if f := fields["Sequence"]; f != nil {
+		def.Sequence, _ = f.Value.(int64)
+	}
+	if f := fields["EndorsementInfo"]; f != nil {
+		if info, ok := f.Value.(*lb.ChaincodeEndorsementInfo); ok {
+			def.Version = info.Version
+			def.InitRequired = info.InitRequired
+			def.EndorsementPlugin = info.EndorsementPlugin
+		}
+	}
+	if f := fields["ValidationInfo"]; f != nil {
+		if info, ok := f.Value.(*lb.ChaincodeValidationInfo); ok {
+			def.ValidationPlugin = info.ValidationPlugin
+			if len(info.ValidationParameter) != 0 {
+				p, err := policy.ApplicationPolicyFromBytes(info.ValidationParameter)
+				if err != nil {
+					return nil, fmt.Errorf("cannot render the endorsement policy of [%s], error=[%v]", name, err)
+				}
+				def.EndorsementPolicy = p
+			}
+		}
+	}
+	if f := fields["Collections"]; f != nil {
+		if pkg, ok := f.Value.(*pb.CollectionConfigPackage); ok {
+			collections, err := newCollections(pkg)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode the collections of [%s], error=[%v]", name, err)
+			}
+			def.Collections = collections
+		}
+	}
+	return def, nil
+}
+
+func newCollections(pkg *pb.CollectionConfigPackage) ([]Collection, error) {
+	var collections []Collection
+	for _, config := range pkg.Config {
+		static := config.GetStaticCollectionConfig()
+		if static == nil {
+			continue
+		}
+		c := Collection{
+			Name:              static.Name,
+			RequiredPeerCount: static.RequiredPeerCount,
+			MaximumPeerCount:  static.MaximumPeerCount,
+			BlockToLive:       static.BlockToLive,
+			MemberOnlyRead:    static.MemberOnlyRead,
+			MemberOnlyWrite:   static.MemberOnlyWrite,
+		}
+		if spe := static.GetMemberOrgsPolicy().GetSignaturePolicy(); spe != nil {
+			p, err := policy.Expression(spe)
+			if err != nil {
+				return nil, err
+			}
+			c.MemberOrgsPolicy = p
+		}
+		// the collection endorsement policy is the peer's copy of common.ApplicationPolicy
+		if ap := static.GetEndorsementPolicy(); ap != nil {
+			c.EndorsementPolicy = ap.GetChannelConfigPolicyReference()
+			if spe := ap.GetSignaturePolicy(); spe != nil {
+				p, err := policy.Expression(spe)
+				if err != nil {
+					return nil, err
+				}
+				c.EndorsementPolicy = p
+			}
+		}
+		collections = append(collections, c)
+	}
+	return collections, nil
+}
+
+// splitNameSequence splits the <name>#<sequence> key of an approval
+func splitNameSequence(nameSeq string) (string, int64, error) {
+	i := strings.LastIndex(nameSeq, "#")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid approval name [%s]", nameSeq)
+	}
+	seq, err := strconv.ParseInt(nameSeq[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid approval name [%s]", nameSeq)
+	}
+	return nameSeq[:i], seq, nil
+}
+
+// Definitions returns the committed chaincode definitions sorted by name
+func (l *Lifecycle) Definitions() []*Definition {
+	defs := make([]*Definition, 0, len(l.definitions))
+	for _, def := range l.definitions {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Definition returns the committed definition of a chaincode, nil if there is none
+func (l *Lifecycle) Definition(name string) *Definition {
+	return l.definitions[name]
+}
+
+// Orgs returns the orgs that hold an implicit collection, i.e. that approved any definition
+func (l *Lifecycle) Orgs() []string {
+	orgs := make([]string, 0, len(l.hashes))
+	for org := range l.hashes {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+	return orgs
+}
+
+// Approvals returns the approval of each org for a sequence of a chaincode. Like the
+// approval status query of the peer, it compares the hashes in the implicit collection of
+// each org with the hashes of the committed definition's parameters, so it works on any
+// peer of the channel even though the approvals are private to the orgs. An approval only
+// matches the committed definition when the sequence is the committed one.
+func (l *Lifecycle) Approvals(name string, sequence int64) []Approval {
+	nameSeq := fmt.Sprintf("%s#%d", name, sequence)
+	committed := l.definitions[name]
+	if committed != nil && committed.Sequence != sequence {
+		committed = nil
+	}
+	metadataHash := hashOf(approvalMetadata())
+
+	var approvals []Approval
+	for _, org := range l.Orgs() {
+		approvals = append(approvals, l.approval(org, nameSeq, committed, metadataHash))
+	}
+	return approvals
+}
+
+func (l *Lifecycle) approval(org, nameSeq string, committed *Definition, metadataHash string) Approval {
+	hashes := l.hashes[org]
+	a := Approval{MSPID: org, Definition: l.approved[org][nameSeq]}
+	a.Approved = string(hashes[keyHash(namespacesSpace+"/metadata/"+nameSeq)]) == metadataHash
+	if a.Approved && committed != nil {
+		a.MatchesCommitted = true
+		for _, field := range parameterFields {
+			value, ok := committed.fields[field]
+			if !ok || string(hashes[keyHash(namespacesSpace+"/fields/"+nameSeq+"/"+field)]) != hashOf(value) {
+				a.MatchesCommitted = false
+				break
+			}
+		}
+	}
+	return a
+}
+
+// approvalMetadata is the metadata the serializer writes for an approval
+func approvalMetadata() []byte {
+	b, _ := proto.Marshal(&lb.StateMetadata{Datatype: "ChaincodeParameters", Fields: parameterFields})
+	return b
+}
+
+func keyHash(key string) string {
+	return hashOf([]byte(key))
+}
+
+func hashOf(b []byte) string {
+	h := sha256.Sum256(b)
+	return string(h[:])
+}
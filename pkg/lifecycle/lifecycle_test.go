@@ -0,0 +1,212 @@
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	lb "github.com/hyperledger/fabric-protos-go/peer/lifecycle"
+	"github.com/hyperledger/fabric/common/policydsl"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+func marshal(t *testing.T, msg proto.Message) []byte {
+	b, err := proto.Marshal(msg)
+	assert.NoError(t, err)
+	return b
+}
+
+func stateBytes(t *testing.T, msg proto.Message) []byte {
+	return marshal(t, &lb.StateData{Type: &lb.StateData_Bytes{Bytes: marshal(t, msg)}})
+}
+
+func put(t *testing.T, db *leveldb.DB, ns, key string, value []byte) {
+	v, err := utils.EncodeValue(&statedb.VersionedValue{Value: value, Version: version.NewHeight(3, 0)})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("mychannel\x00d"+ns+"\x00"+key), v, nil))
+}
+
+// putApproval writes the approval of an org the way the serializer does: the cleartext
+// into the implicit collection when private is set, the hashes in any case
+func putApproval(t *testing.T, db *leveldb.DB, org, nameSeq string, fields map[string][]byte, private bool) {
+	entries := map[string][]byte{"namespaces/metadata/" + nameSeq: approvalMetadata()}
+	for field, value := range fields {
+		entries["namespaces/fields/"+nameSeq+"/"+field] = value
+	}
+	for key, value := range entries {
+		keyHash, valueHash := sha256.Sum256([]byte(key)), sha256.Sum256(value)
+		put(t, db, Namespace+"$$h"+ImplicitCollectionPrefix+org, string(keyHash[:]), valueHash[:])
+		if private {
+			put(t, db, Namespace+"$$p"+ImplicitCollectionPrefix+org, key, value)
+		}
+	}
+}
+
+// putDefinition commits sequence 5 of mycc and returns its parameter fields
+func putDefinition(t *testing.T, db *leveldb.DB) map[string][]byte {
+	validationParameter := marshal(t, &common.ApplicationPolicy{Type: &common.ApplicationPolicy_ChannelConfigPolicyReference{ChannelConfigPolicyReference: "/Channel/Application/Endorsement"}})
+	fields := map[string][]byte{
+		"EndorsementInfo": stateBytes(t, &lb.ChaincodeEndorsementInfo{Version: "1.0", InitRequired: true, EndorsementPlugin: "escc"}),
+		"ValidationInfo":  stateBytes(t, &lb.ChaincodeValidationInfo{ValidationPlugin: "vscc", ValidationParameter: validationParameter}),
+		"Collections": stateBytes(t, &pb.CollectionConfigPackage{Config: []*pb.CollectionConfig{{
+			Payload: &pb.CollectionConfig_StaticCollectionConfig{StaticCollectionConfig: &pb.StaticCollectionConfig{
+				Name:              "coll1",
+				MemberOrgsPolicy:  &pb.CollectionPolicyConfig{Payload: &pb.CollectionPolicyConfig_SignaturePolicy{SignaturePolicy: policydsl.SignedByAnyMember([]string{"Org1MSP", "Org2MSP"})}},
+				RequiredPeerCount: 1,
+				MaximumPeerCount:  2,
+				BlockToLive:       100,
+				MemberOnlyRead:    true,
+			}},
+		}}}),
+	}
+	put(t, db, Namespace, "namespaces/metadata/mycc", marshal(t, &lb.StateMetadata{Datatype: "ChaincodeDefinition", Fields: []string{"Sequence", "EndorsementInfo", "ValidationInfo", "Collections"}}))
+	put(t, db, Namespace, "namespaces/fields/mycc/Sequence", marshal(t, &lb.StateData{Type: &lb.StateData_Int64{Int64: 5}}))
+	for field, value := range fields {
+		put(t, db, Namespace, "namespaces/fields/mycc/"+field, value)
+	}
+	return fields
+}
+
+// putPackage maps a package to an approval the way the serializer does
+func putPackage(t *testing.T, db *leveldb.DB, org, nameSeq, packageID string, private bool) {
+	entries := map[string][]byte{
+		"chaincode-sources/metadata/" + nameSeq:              marshal(t, &lb.StateMetadata{Datatype: "ChaincodeLocalPackage", Fields: []string{"PackageID"}}),
+		"chaincode-sources/fields/" + nameSeq + "/PackageID": packageIDField(packageID),
+	}
+	for key, value := range entries {
+		keyHash, valueHash := sha256.Sum256([]byte(key)), sha256.Sum256(value)
+		put(t, db, Namespace+"$$h"+ImplicitCollectionPrefix+org, string(keyHash[:]), valueHash[:])
+		if private {
+			put(t, db, Namespace+"$$p"+ImplicitCollectionPrefix+org, key, value)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(dir, nil)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+
+	fields := putDefinition(t, db)
+
+	otherVersion := map[string][]byte{}
+	for field, value := range fields {
+		otherVersion[field] = value
+	}
+	otherVersion["EndorsementInfo"] = stateBytes(t, &lb.ChaincodeEndorsementInfo{Version: "2.0", InitRequired: true, EndorsementPlugin: "escc"})
+
+	putApproval(t, db, "Org1MSP", "mycc#5", fields, true)
+	putApproval(t, db, "Org2MSP", "mycc#5", otherVersion, false)
+	putApproval(t, db, "Org3MSP", "mycc#4", fields, false)
+
+	l, err := Load(db, "mychannel")
+	assert.NoError(t, err)
+	expected := &Definition{
+		Name:              "mycc",
+		Sequence:          5,
+		Version:           "1.0",
+		InitRequired:      true,
+		EndorsementPlugin: "escc",
+		ValidationPlugin:  "vscc",
+		EndorsementPolicy: "/Channel/Application/Endorsement",
+		Collections: []Collection{{
+			Name:              "coll1",
+			MemberOrgsPolicy:  "OR('Org1MSP.member', 'Org2MSP.member')",
+			RequiredPeerCount: 1,
+			MaximumPeerCount:  2,
+			BlockToLive:       100,
+			MemberOnlyRead:    true,
+		}},
+	}
+	defs := l.Definitions()
+	assert.Len(t, defs, 1)
+	def := *defs[0]
+	def.fields = nil
+	assert.Equal(t, expected, &def)
+	assert.Nil(t, l.Definition("other"))
+	assert.Equal(t, []string{"Org1MSP", "Org2MSP", "Org3MSP"}, l.Orgs())
+
+	approvals := l.Approvals("mycc", 5)
+	assert.Len(t, approvals, 3)
+	assert.Equal(t, "Org1MSP", approvals[0].MSPID)
+	assert.True(t, approvals[0].Approved)
+	assert.True(t, approvals[0].MatchesCommitted)
+	assert.Equal(t, expected, approvals[0].Definition)
+	assert.Equal(t, Approval{MSPID: "Org2MSP", Approved: true}, approvals[1])
+	assert.Equal(t, Approval{MSPID: "Org3MSP"}, approvals[2])
+
+	// an approval of another sequence never matches the committed definition
+	approvals = l.Approvals("mycc", 4)
+	assert.Equal(t, Approval{MSPID: "Org3MSP", Approved: true}, approvals[2])
+}
+
+func TestCheckPackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(filepath.Join(dir, "stateLeveldb"), nil)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+
+	fields := putDefinition(t, db)
+	otherVersion := map[string][]byte{}
+	for field, value := range fields {
+		otherVersion[field] = value
+	}
+	otherVersion["EndorsementInfo"] = stateBytes(t, &lb.ChaincodeEndorsementInfo{Version: "2.0"})
+
+	packageID := "mycc_1:" + strings.Repeat("ab", 32)
+	putApproval(t, db, "Org1MSP", "mycc#5", fields, true)
+	putPackage(t, db, "Org1MSP", "mycc#4", "mycc_0:"+strings.Repeat("cd", 32), true)
+	putPackage(t, db, "Org1MSP", "mycc#5", packageID, true)
+	putApproval(t, db, "Org2MSP", "mycc#5", otherVersion, false)
+	putPackage(t, db, "Org2MSP", "mycc#5", "another package", false)
+	putApproval(t, db, "Org3MSP", "mycc#5", fields, false)
+	putPackage(t, db, "Org3MSP", "mycc#5", "", false)
+	putApproval(t, db, "Org4MSP", "mycc#5", fields, false)
+
+	chaincodes := filepath.Join(dir, "lifecycle", "chaincodes")
+	assert.NoError(t, os.MkdirAll(chaincodes, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(chaincodes, "mycc_1."+strings.Repeat("ab", 32)+".tar.gz"), nil, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(chaincodes, "README"), nil, 0644))
+	installed, err := InstalledPackages(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{packageID: true}, installed)
+
+	l, err := Load(db, "mychannel")
+	assert.NoError(t, err)
+	mappings, err := l.Packages()
+	assert.NoError(t, err)
+	assert.Equal(t, []PackageMapping{
+		{MSPID: "Org1MSP", Name: "mycc", Sequence: 4, PackageID: "mycc_0:" + strings.Repeat("cd", 32)},
+		{MSPID: "Org1MSP", Name: "mycc", Sequence: 5, PackageID: packageID},
+	}, mappings)
+
+	checks := l.CheckPackages(installed)
+	assert.Equal(t, []PackageCheck{
+		{MSPID: "Org1MSP", Name: "mycc", Sequence: 5, Mapped: true, PackageID: packageID},
+		{MSPID: "Org2MSP", Name: "mycc", Sequence: 5, Mapped: true, Problems: []string{"the approval does not match the committed definition"}},
+		{MSPID: "Org3MSP", Name: "mycc", Sequence: 5, Mapped: true, Problems: []string{"an empty package is mapped, the chaincode does not run on the org's peers"}},
+		{MSPID: "Org4MSP", Name: "mycc", Sequence: 5, Problems: []string{"no package is mapped to the committed sequence"}},
+	}, checks)
+	assert.True(t, checks[0].OK())
+
+	checks = l.CheckPackages(map[string]bool{})
+	assert.Equal(t, []string{"package [" + packageID + "] is not installed"}, checks[0].Problems)
+}
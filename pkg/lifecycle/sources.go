@@ -0,0 +1,133 @@
+package lifecycle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	lb "github.com/hyperledger/fabric-protos-go/peer/lifecycle"
+)
+
+// packageFileMatcher matches the package files below lifecycle/chaincodes: <label>.<hash>.tar.gz
+var packageFileMatcher = regexp.MustCompile("^(.+)[.]([0-9a-f]{64})[.]tar[.]gz$")
+
+// PackageMapping is the package an org mapped to a sequence of a chaincode when approving it
+type PackageMapping struct {
+	MSPID     string `json:"mspid"`
+	Name      string `json:"name"`
+	Sequence  int64  `json:"sequence"`
+	PackageID string `json:"package_id"` // empty when the chaincode must not run on the org's peers
+}
+
+// Packages returns the package ids mapped by the orgs whose implicit collection is held in cleartext,
+// which are the orgs of the peer the state db belongs to
+func (l *Lifecycle) Packages() ([]PackageMapping, error) {
+	var mappings []PackageMapping
+	for org, byName := range l.sources {
+		for nameSeq, packageID := range byName {
+			name, seq, err := splitNameSequence(nameSeq)
+			if err != nil {
+				return nil, err
+			}
+			mappings = append(mappings, PackageMapping{MSPID: org, Name: name, Sequence: seq, PackageID: packageID})
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		a, b := mappings[i], mappings[j]
+		if a.MSPID != b.MSPID {
+			return a.MSPID < b.MSPID
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Sequence < b.Sequence
+	})
+	return mappings, nil
+}
+
+// PackageCheck is the package state of an org for a committed definition
+type PackageCheck struct {
+	MSPID    string `json:"mspid"`
+	Name     string `json:"name"`
+	Sequence int64  `json:"sequence"`
+	Mapped   bool   `json:"mapped"` // a package, possibly empty, is mapped to the committed sequence
+	// PackageID is only known on the peers of the org itself
+	PackageID string   `json:"package_id,omitempty"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// OK reports whether the org approved the committed definition with a package
+func (c *PackageCheck) OK() bool {
+	return len(c.Problems) == 0
+}
+
+// CheckPackages joins the package mappings of each org with the committed definitions.
+// The mappings are checked through the hashes of the implicit collections, so orgs other
+// than the peer's own are covered as well. When installed is not nil, the package ids
+// known in cleartext are also looked up in it, see InstalledPackages.
+func (l *Lifecycle) CheckPackages(installed map[string]bool) []PackageCheck {
+	metadataHash := hashOf(approvalMetadata())
+	emptyPackageHash := hashOf(packageIDField(""))
+
+	var checks []PackageCheck
+	for _, def := range l.Definitions() {
+		nameSeq := fmt.Sprintf("%s#%d", def.Name, def.Sequence)
+		for _, org := range l.Orgs() {
+			c := PackageCheck{MSPID: org, Name: def.Name, Sequence: def.Sequence}
+			a := l.approval(org, nameSeq, def, metadataHash)
+			switch {
+			case !a.Approved:
+				c.Problems = append(c.Problems, "the committed sequence is not approved")
+			case !a.MatchesCommitted:
+				c.Problems = append(c.Problems, "the approval does not match the committed definition")
+			}
+
+			valueHash, mapped := l.hashes[org][keyHash(sourcesSpace+"/fields/"+nameSeq+"/PackageID")]
+			c.Mapped = mapped
+			packageID, known := l.sources[org][nameSeq]
+			c.PackageID = packageID
+			switch {
+			case !mapped:
+				c.Problems = append(c.Problems, "no package is mapped to the committed sequence")
+			case string(valueHash) == emptyPackageHash:
+				c.Problems = append(c.Problems, "an empty package is mapped, the chaincode does not run on the org's peers")
+			case known && hashOf(packageIDField(packageID)) != string(valueHash):
+				c.Problems = append(c.Problems, fmt.Sprintf("package [%s] does not match the hash of the mapping", packageID))
+			case known && installed != nil && !installed[packageID]:
+				c.Problems = append(c.Problems, fmt.Sprintf("package [%s] is not installed", packageID))
+			}
+			checks = append(checks, c)
+		}
+	}
+	return checks
+}
+
+// packageIDField is the serialized PackageID field of a ChaincodeLocalPackage
+func packageIDField(packageID string) []byte {
+	b, _ := proto.Marshal(&lb.StateData{Type: &lb.StateData_String_{String_: packageID}})
+	return b
+}
+
+// InstalledPackages returns the ids of the chaincode packages installed on a peer,
+// read from the file names below lifecycle/chaincodes of the production directory
+func InstalledPackages(productionDir string) (map[string]bool, error) {
+	dir := filepath.Join(productionDir, "lifecycle", "chaincodes")
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot read installed chaincodes: [%s], error=[%v]", dir, err)
+	}
+	installed := map[string]bool{}
+	for _, file := range files {
+		if matches := packageFileMatcher.FindStringSubmatch(file.Name()); matches != nil {
+			installed[matches[1]+":"+matches[2]] = true
+		}
+	}
+	return installed, nil
+}
@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// Expression renders a signature policy the way it is written in the policy language,
+// e.g. AND('Org1MSP.peer', OutOf(2, 'Org2MSP.member', 'Org3MSP.member', 'Org4MSP.admin'))
+func Expression(spe *common.SignaturePolicyEnvelope) (string, error) {
+	if spe.Rule == nil {
+		return "", fmt.Errorf("signature policy has no rule")
+	}
+	principals := make([]string, len(spe.Identities))
+	for i, p := range spe.Identities {
+		s, err := Principal(p)
+		if err != nil {
+			return "", err
+		}
+		principals[i] = s
+	}
+	return rule(spe.Rule, principals)
+}
+
+// ExpressionFromBytes renders a marshaled SignaturePolicyEnvelope,
+// e.g. the VALIDATION_PARAMETER metadata of a key
+func ExpressionFromBytes(b []byte) (string, error) {
+	spe := &common.SignaturePolicyEnvelope{}
+	if err := proto.Unmarshal(b, spe); err != nil {
+		return "", fmt.Errorf("cannot decode signature policy, error=[%v]", err)
+	}
+	return Expression(spe)
+}
+
+// ApplicationPolicy renders a chaincode or collection endorsement policy: the expression of a
+// signature policy, or the path of a channel config policy such as /Channel/Application/Endorsement
+func ApplicationPolicy(ap *common.ApplicationPolicy) (string, error) {
+	switch t := ap.Type.(type) {
+	case *common.ApplicationPolicy_SignaturePolicy:
+		return Expression(t.SignaturePolicy)
+	case *common.ApplicationPolicy_ChannelConfigPolicyReference:
+		return t.ChannelConfigPolicyReference, nil
+	default:
+		return "", fmt.Errorf("unknown application policy %T", ap.Type)
+	}
+}
+
+// ApplicationPolicyFromBytes renders a marshaled ApplicationPolicy,
+// e.g. the validation parameter of a chaincode definition
+func ApplicationPolicyFromBytes(b []byte) (string, error) {
+	ap := &common.ApplicationPolicy{}
+	if err := proto.Unmarshal(b, ap); err != nil {
+		return "", fmt.Errorf("cannot decode application policy, error=[%v]", err)
+	}
+	return ApplicationPolicy(ap)
+}
+
+func rule(r *common.SignaturePolicy, principals []string) (string, error) {
+	switch t := r.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		if t.SignedBy < 0 || int(t.SignedBy) >= len(principals) {
+			return "", fmt.Errorf("signature policy refers to identity [%d] of %d", t.SignedBy, len(principals))
+		}
+		return principals[t.SignedBy], nil
+	case *common.SignaturePolicy_NOutOf_:
+		rules := t.NOutOf.Rules
+		subs := make([]string, len(rules))
+		for i, sub := range rules {
+			s, err := rule(sub, principals)
+			if err != nil {
+				return "", err
+			}
+			subs[i] = s
+		}
+		n := int(t.NOutOf.N)
+		switch {
+		case n == 1 && len(rules) == 1:
+			return subs[0], nil
+		case n == len(rules) && n > 1:
+			return fmt.Sprintf("AND(%s)", strings.Join(subs, ", ")), nil
+		case n == 1:
+			return fmt.Sprintf("OR(%s)", strings.Join(subs, ", ")), nil
+		default:
+			return fmt.Sprintf("OutOf(%d, %s)", n, strings.Join(subs, ", ")), nil
+		}
+	default:
+		return "", fmt.Errorf("unknown signature policy rule %T", r.Type)
+	}
+}
+
+// Principal renders an MSP principal: 'Org1MSP.member' for roles, identities, OUs
+// and anonymity principals in a descriptive form
+func Principal(p *msp.MSPPrincipal) (string, error) {
+	switch p.PrincipalClassification {
+	case msp.MSPPrincipal_ROLE:
+		role := &msp.MSPRole{}
+		if err := proto.Unmarshal(p.Principal, role); err != nil {
+			return "", fmt.Errorf("cannot decode role principal, error=[%v]", err)
+		}
+		return fmt.Sprintf("'%s.%s'", role.MspIdentifier, strings.ToLower(role.Role.String())), nil
+	case msp.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &msp.OrganizationUnit{}
+		if err := proto.Unmarshal(p.Principal, ou); err != nil {
+			return "", fmt.Errorf("cannot decode organization unit principal, error=[%v]", err)
+		}
+		return fmt.Sprintf("OU('%s', '%s')", ou.MspIdentifier, ou.OrganizationalUnitIdentifier), nil
+	case msp.MSPPrincipal_IDENTITY:
+		id := &msp.SerializedIdentity{}
+		if err := proto.Unmarshal(p.Principal, id); err != nil {
+			return "", fmt.Errorf("cannot decode identity principal, error=[%v]", err)
+		}
+		return fmt.Sprintf("Identity('%s', '%s')", id.Mspid, subject(id.IdBytes)), nil
+	case msp.MSPPrincipal_ANONYMITY:
+		anonymity := &msp.MSPIdentityAnonymity{}
+		if err := proto.Unmarshal(p.Principal, anonymity); err != nil {
+			return "", fmt.Errorf("cannot decode anonymity principal, error=[%v]", err)
+		}
+		return fmt.Sprintf("Anonymity(%s)", strings.ToLower(anonymity.AnonymityType.String())), nil
+	case msp.MSPPrincipal_COMBINED:
+		combined := &msp.CombinedPrincipal{}
+		if err := proto.Unmarshal(p.Principal, combined); err != nil {
+			return "", fmt.Errorf("cannot decode combined principal, error=[%v]", err)
+		}
+		subs := make([]string, len(combined.Principals))
+		for i, sub := range combined.Principals {
+			s, err := Principal(sub)
+			if err != nil {
+				return "", err
+			}
+			subs[i] = s
+		}
+		return fmt.Sprintf("Combined(%s)", strings.Join(subs, ", ")), nil
+	default:
+		return "", fmt.Errorf("unknown principal classification [%d]", p.PrincipalClassification)
+	}
+}
+
+// subject returns the subject of a PEM certificate, or the hash of the bytes for other identities
+func subject(idBytes []byte) string {
+	if b, _ := pem.Decode(idBytes); b != nil {
+		if cert, err := x509.ParseCertificate(b.Bytes); err == nil {
+			return cert.Subject.String()
+		}
+	}
+	h := sha256.Sum256(idBytes)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
@@ -0,0 +1,67 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric/common/policydsl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpression(t *testing.T) {
+	for _, expression := range []string{
+		"'Org1MSP.member'",
+		"AND('Org1MSP.peer', 'Org2MSP.admin')",
+		"OR('Org1MSP.client', 'Org2MSP.orderer')",
+		"AND('Org1MSP.peer', OutOf(2, 'Org2MSP.member', 'Org3MSP.member', 'Org4MSP.admin'))",
+	} {
+		spe, err := policydsl.FromString(expression)
+		if expression == "'Org1MSP.member'" {
+			// the language has no single principal expression, SignedByMspMember builds OutOf(1, 'Org1MSP.member')
+			spe, err = policydsl.SignedByMspMember("Org1MSP"), nil
+		}
+		assert.NoError(t, err)
+		rendered, err := Expression(spe)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expression, rendered)
+
+		b, err := proto.Marshal(spe)
+		assert.NoError(t, err)
+		rendered, err = ExpressionFromBytes(b)
+		assert.NoError(t, err)
+		assert.Equal(t, expression, rendered)
+	}
+
+	ou, err := proto.Marshal(&msp.OrganizationUnit{MspIdentifier: "Org1MSP", OrganizationalUnitIdentifier: "sales"})
+	assert.NoError(t, err)
+	id, err := proto.Marshal(&msp.SerializedIdentity{Mspid: "Org2MSP", IdBytes: []byte("not a certificate")})
+	assert.NoError(t, err)
+	spe := &common.SignaturePolicyEnvelope{
+		Rule: policydsl.NOutOf(1, []*common.SignaturePolicy{policydsl.SignedBy(0), policydsl.SignedBy(1)}),
+		Identities: []*msp.MSPPrincipal{
+			{PrincipalClassification: msp.MSPPrincipal_ORGANIZATION_UNIT, Principal: ou},
+			{PrincipalClassification: msp.MSPPrincipal_IDENTITY, Principal: id},
+		},
+	}
+	rendered, err := Expression(spe)
+	assert.NoError(t, err)
+	assert.Equal(t, "OR(OU('Org1MSP', 'sales'), Identity('Org2MSP', 'sha256:47209c9b7af839de69e9a9cd625e9182c1ad63dae79ed88a2dd680fe34218620'))", rendered)
+
+	spe.Rule = policydsl.SignedBy(2)
+	_, err = Expression(spe)
+	assert.EqualError(t, err, "signature policy refers to identity [2] of 2")
+
+	_, err = ExpressionFromBytes([]byte{0xff})
+	assert.Error(t, err)
+
+	ap, err := proto.Marshal(&common.ApplicationPolicy{Type: &common.ApplicationPolicy_ChannelConfigPolicyReference{ChannelConfigPolicyReference: "/Channel/Application/Endorsement"}})
+	assert.NoError(t, err)
+	rendered, err = ApplicationPolicyFromBytes(ap)
+	assert.NoError(t, err)
+	assert.Equal(t, "/Channel/Application/Endorsement", rendered)
+	rendered, err = ApplicationPolicy(&common.ApplicationPolicy{Type: &common.ApplicationPolicy_SignaturePolicy{SignaturePolicy: policydsl.SignedByMspPeer("Org1MSP")}})
+	assert.NoError(t, err)
+	assert.Equal(t, "'Org1MSP.peer'", rendered)
+}
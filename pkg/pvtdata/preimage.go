@@ -0,0 +1,193 @@
+package pvtdata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	goproto "github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+// hashedKey identifies a private key by its hash, private data is hashed per collection
+type hashedKey struct {
+	ns, coll, keyHash string
+}
+
+// Resolver maps the hashes of private keys to their cleartext
+type Resolver struct {
+	keys map[hashedKey]string
+}
+
+// NewResolver returns a Resolver that knows no key yet
+func NewResolver() *Resolver {
+	return &Resolver{keys: map[hashedKey]string{}}
+}
+
+// AddKey records the cleartext of a private key
+func (r *Resolver) AddKey(ns, coll, key string) {
+	h := sha256.Sum256([]byte(key))
+	r.keys[hashedKey{ns, coll, string(h[:])}] = key
+}
+
+// Len returns the number of keys known in cleartext
+func (r *Resolver) Len() int {
+	return len(r.keys)
+}
+
+// Resolve returns the cleartext of a private key hash
+func (r *Resolver) Resolve(ns, coll string, keyHash []byte) (string, bool) {
+	key, ok := r.keys[hashedKey{ns, coll, string(keyHash)}]
+	return key, ok
+}
+
+// AddStateDB adds the private keys a stateLeveldb holds in cleartext for a channel
+func (r *Resolver) AddStateDB(db *leveldb.DB, channel string) error {
+	return walkPrivateState(db, channel, func(record *state.Record) error {
+		if !record.Hashed {
+			r.AddKey(record.Namespace, record.Collection, record.Key)
+		}
+		return nil
+	})
+}
+
+// AddPvtdataStore adds the keys of the private rwsets in a pvtdataStore for a channel.
+// It also knows keys that were deleted or overwritten since and are no longer in the state db.
+func (r *Resolver) AddPvtdataStore(db *leveldb.DB, channel string) error {
+	iter := db.NewIterator(prefixRange(channel, PvtDataKeyPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv := PvtDataKV{iter.Key(), iter.Value()}
+		ns, coll, err := kv.Namespace()
+		if err != nil {
+			return err
+		}
+		collPvtdata := &rwset.CollectionPvtReadWriteSet{}
+		if err := goproto.Unmarshal(iter.Value(), collPvtdata); err != nil {
+			return err
+		}
+		kvRWSet := &kvrwset.KVRWSet{}
+		if err := goproto.Unmarshal(collPvtdata.Rwset, kvRWSet); err != nil {
+			return err
+		}
+		for _, read := range kvRWSet.Reads {
+			r.AddKey(ns, coll, read.Key)
+		}
+		for _, write := range kvRWSet.Writes {
+			r.AddKey(ns, coll, write.Key)
+		}
+	}
+	return iter.Error()
+}
+
+// HashedEntry is a hashed private key of the state db
+type HashedEntry struct {
+	Namespace  string
+	Collection string
+	KeyHash    string // hex encoded
+	Key        string // cleartext, empty if unknown
+	Resolved   bool
+	Version    *version.Height
+}
+
+func (e HashedEntry) String() string {
+	if e.Resolved {
+		return fmt.Sprintf("%s/%s/%s: %s", e.Namespace, e.Collection, e.KeyHash, e.Key)
+	}
+	return fmt.Sprintf("%s/%s/%s: no preimage", e.Namespace, e.Collection, e.KeyHash)
+}
+
+// PreimageReport lists the hashed private keys of a channel with the cleartext the peer knows
+type PreimageReport struct {
+	Channel    string
+	Resolved   []HashedEntry
+	Unresolved []HashedEntry // keys of collections the peer is not a member of, or purged data
+}
+
+// Unknown returns the number of unresolved keys per <namespace>/<collection>
+func (r *PreimageReport) Unknown() map[string]int {
+	counts := map[string]int{}
+	for _, e := range r.Unresolved {
+		counts[e.Namespace+"/"+e.Collection]++
+	}
+	return counts
+}
+
+// Annotate resolves every hashed private key of the channel in a stateLeveldb
+func (r *Resolver) Annotate(db *leveldb.DB, channel string) (*PreimageReport, error) {
+	report := &PreimageReport{Channel: channel}
+	err := walkPrivateState(db, channel, func(record *state.Record) error {
+		if !record.Hashed {
+			return nil
+		}
+		e := HashedEntry{
+			Namespace:  record.Namespace,
+			Collection: record.Collection,
+			KeyHash:    hex.EncodeToString([]byte(record.Key)),
+			Version:    record.Version,
+		}
+		e.Key, e.Resolved = r.Resolve(record.Namespace, record.Collection, []byte(record.Key))
+		if e.Resolved {
+			report.Resolved = append(report.Resolved, e)
+		} else {
+			report.Unresolved = append(report.Unresolved, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortHashedEntries(report.Resolved)
+	sortHashedEntries(report.Unresolved)
+	return report, nil
+}
+
+// walkPrivateState calls fn with every private data entry, hashed or cleartext, of a channel
+func walkPrivateState(db *leveldb.DB, channel string, fn func(*state.Record) error) error {
+	f, err := format.Detect(db)
+	if err != nil {
+		return err
+	}
+	iter := db.NewIterator(lutil.BytesPrefix(append([]byte(channel), 0x00)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := state.ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return err
+		}
+		if kv == nil || kv.Type() == state.FormatVersion || kv.Type() == state.SavePoint {
+			continue
+		}
+		record, err := kv.Decode()
+		if err != nil {
+			return err
+		}
+		if record.Collection == "" {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+func sortHashedEntries(entries []HashedEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.KeyHash < b.KeyHash
+	})
+}
@@ -20,6 +20,10 @@ var (
 	EmptyValue = []byte{}
 )
 
+// ParseKV parses an entry of a pvtdataStore. The pvtdataStore keeps the same key layout
+// since 1.4 and has no format key, so stores of every data format are parsed alike and
+// there is no format aware variant: 1.4 additionally writes the pending commit key, which
+// is skipped, and 2.2 adds the deprioritized missing data group.
 func ParseKV(key []byte, value []byte, channel string) (KVSet, error) {
 	nsKey := bytes.SplitN(key, []byte{0x00}, 2)
 	if string(nsKey[0]) != channel && channel != "" {
@@ -41,8 +45,8 @@ func ParseKV(key []byte, value []byte, channel string) (KVSet, error) {
 	// TODO
 	case ExpiryKeyPrefix:
 		err = fmt.Errorf("expiryKeyPrefix")
-	case EligiblePrioritizedMissingDataGroup:
-		err = fmt.Errorf("eligibleMissingDataKeyPrefix")
+	case EligiblePrioritizedMissingDataGroup, EligibleDeprioritizedMissingDataGroup:
+		kvSet = EligibleMissingDataKV{key, value}
 	case IneligibleMissingDataKeyGroup:
 		kvSet = IneligibleMissingDataKV{key, value}
 
@@ -50,8 +54,6 @@ func ParseKV(key []byte, value []byte, channel string) (KVSet, error) {
 		err = fmt.Errorf("collElgKeyPrefix")
 	case LastUpdatedOldBlocksKey:
 		err = fmt.Errorf("lastUpdatedOldBlocksKey")
-	case EligibleDeprioritizedMissingDataGroup:
-		err = fmt.Errorf("EligibleDeprioritizedMissingDataGroup")
 	default:
 		err = fmt.Errorf("unknown prefix")
 	}
@@ -1,11 +1,31 @@
 package pvtdata
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	goproto "github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/hyperledger/fabric/protoutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/the-medium/ledger-parser/internal/testutil"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/willf/bitset"
 )
 
 func TestParseKV(t *testing.T) {
@@ -28,3 +48,191 @@ func TestParseKV(t *testing.T) {
 	err = iter.Error()
 	assert.NoError(t, err)
 }
+
+// TestParseKVV14 parses the entries of a pvtdataStore the way a 1.4 peer encodes them
+func TestParseKVV14(t *testing.T) {
+	// 1.4 keeps a pending commit marker between writing a batch and committing the block
+	kv, err := ParseKV(testutil.Key("mychannel", []byte{PendingCommitKey}), EmptyValue, "")
+	assert.NoError(t, err)
+	assert.Nil(t, kv)
+
+	kv, err = ParseKV(testutil.Key("mychannel", []byte{LastCommittedBlkkey}), goproto.EncodeVarint(3), "")
+	assert.NoError(t, err)
+	assert.IsType(t, LastCommittedBlockKV{}, kv)
+
+	kv, err = ParseKV(dataKey(3, 1, "coll1"), pvtRwSet("coll1"), "")
+	assert.NoError(t, err)
+	blkNum, txNum, err := kv.(PvtDataKV).Location()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{3, 1}, []uint64{blkNum, txNum})
+	ns, coll, err := kv.(PvtDataKV).Namespace()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mycc", "coll1"}, []string{ns, coll})
+
+	// 1.4 encodes missing data with a single isEligible flag, into the same groups as 2.x
+	missingBytes, err := bitset.New(2).Set(1).MarshalBinary()
+	assert.NoError(t, err)
+	eligibleKey := append([]byte{EligiblePrioritizedMissingDataGroup}, EncodeReverseOrderVarUint64(3)...)
+	kv, err = ParseKV(testutil.Key("mychannel", append(eligibleKey, "mycc\x00coll1"...)), missingBytes, "")
+	assert.NoError(t, err)
+	ns, coll, err = kv.(EligibleMissingDataKV).Namespace()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mycc", "coll1"}, []string{ns, coll})
+	txNums, err := kv.(EligibleMissingDataKV).TxNums()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1}, txNums)
+
+	ineligibleKey := append([]byte{IneligibleMissingDataKeyGroup}, "mycc\x00coll2\x00"...)
+	kv, err = ParseKV(testutil.Key("mychannel", append(ineligibleKey, EncodeReverseOrderVarUint64(3)...)), missingBytes, "")
+	assert.NoError(t, err)
+	blkNum, _, err = kv.(IneligibleMissingDataKV).Location()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), blkNum)
+}
+
+func pvtTx(txID string, colls ...string) *testutil.Tx {
+	nsRwSet := &rwsetutil.NsRwSet{NameSpace: "mycc", KvRwSet: &kvrwset.KVRWSet{}}
+	for _, coll := range colls {
+		hash := sha256.Sum256(pvtRwSet(coll))
+		nsRwSet.CollHashedRwSets = append(nsRwSet.CollHashedRwSets, &rwsetutil.CollHashedRwSet{
+			CollectionName: coll,
+			HashedRwSet:    &kvrwset.HashedRWSet{},
+			PvtRwSetHash:   hash[:],
+		})
+	}
+	return &testutil.Tx{
+		TxID:           txID,
+		ChannelID:      "mychannel",
+		Type:           common.HeaderType_ENDORSER_TRANSACTION,
+		Timestamp:      time.Now(),
+		MSPID:          "Org1MSP",
+		Chaincode:      "mycc",
+		RWSet:          &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{nsRwSet}},
+		ValidationCode: peer.TxValidationCode_VALID,
+	}
+}
+
+func pvtRwSet(coll string) []byte {
+	return protoutil.MarshalOrPanic(&kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "k", Value: []byte(coll)}}})
+}
+
+func dataKey(blkNum, txNum uint64, coll string) []byte {
+	key := append([]byte{PvtDataKeyPrefix}, version.NewHeight(blkNum, txNum).ToBytes()...)
+	return testutil.Key("mychannel", append(append(key, "mycc\x00"...), coll...))
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pvtdata")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{pvtTx("tx1", "coll1", "coll2")},
+		[]*testutil.Tx{pvtTx("tx2", "coll1"), pvtTx("tx3", "coll1"), pvtTx("tx4", "coll2")},
+	)
+	assert.NoError(t, err)
+	chainsDir := filepath.Join(dir, "ledgersData", "chains", "chains")
+	indexDir := filepath.Join(dir, "ledgersData", "chains", "index")
+	assert.NoError(t, testutil.WriteLedger(chainsDir, indexDir, "mychannel", true, blocks...))
+	ledger, err := block.OpenLedger(dir)
+	assert.NoError(t, err)
+
+	db, err := leveldb.OpenFile(filepath.Join(dir, "pvtdataStore"), nil)
+	assert.NoError(t, err)
+	defer db.Close()
+	put := func(key []byte, coll string, rws []byte) {
+		value := protoutil.MarshalOrPanic(&rwset.CollectionPvtReadWriteSet{CollectionName: coll, Rwset: rws})
+		assert.NoError(t, db.Put(key, value, nil))
+	}
+	put(dataKey(0, 0, "coll1"), "coll1", pvtRwSet("coll1"))
+	put(dataKey(0, 0, "coll2"), "coll2", pvtRwSet("tampered"))
+	put(dataKey(1, 5, "coll1"), "coll1", pvtRwSet("coll1"))
+
+	missing := bitset.New(3).Set(0)
+	missingBytes, err := missing.MarshalBinary()
+	assert.NoError(t, err)
+	eligibleKey := append([]byte{EligiblePrioritizedMissingDataGroup}, EncodeReverseOrderVarUint64(1)...)
+	assert.NoError(t, db.Put(testutil.Key("mychannel", append(eligibleKey, "mycc\x00coll1"...)), missingBytes, nil))
+	ineligibleKey := append([]byte{IneligibleMissingDataKeyGroup}, "mycc\x00coll2\x00"...)
+	// tx4 is transaction 2 of block 1, transaction 0 did not write coll2
+	ineligibleBytes, err := bitset.New(3).Set(0).Set(2).MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put(testutil.Key("mychannel", append(ineligibleKey, EncodeReverseOrderVarUint64(1)...)), ineligibleBytes, nil))
+
+	kv, err := ParseKV(testutil.Key("mychannel", append(eligibleKey, "mycc\x00coll1"...)), missingBytes, "")
+	assert.NoError(t, err)
+	txNums, err := kv.(EligibleMissingDataKV).TxNums()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{0}, txNums)
+	kv, err = ParseKV(testutil.Key("mychannel", append(ineligibleKey, EncodeReverseOrderVarUint64(1)...)), ineligibleBytes, "")
+	assert.NoError(t, err)
+	txNums, err = kv.(IneligibleMissingDataKV).TxNums()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{0, 2}, txNums)
+
+	r, err := Verify(db, ledger, "mychannel")
+	assert.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Equal(t, 2, r.Checked)
+	assert.Equal(t, 1, r.Matched)
+	assert.Equal(t, 1, r.Ineligible)
+
+	var kinds []int
+	for _, f := range r.Findings {
+		kinds = append(kinds, f.Kind)
+	}
+	assert.Equal(t, []int{HashMismatch, MissingEligible, Unaccounted, Orphan}, kinds)
+	assert.Equal(t, Finding{Orphan, 1, 5, "mycc", "coll1", "no valid transaction of the block references the private data"}, r.Findings[3])
+}
+
+func TestResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preimage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pvtdataDB, err := leveldb.OpenFile(filepath.Join(dir, "pvtdataStore"), nil)
+	assert.NoError(t, err)
+	defer pvtdataDB.Close()
+	value := protoutil.MarshalOrPanic(&rwset.CollectionPvtReadWriteSet{CollectionName: "coll1", Rwset: pvtRwSet("coll1")})
+	assert.NoError(t, pvtdataDB.Put(dataKey(1, 0, "coll1"), value, nil))
+
+	stateDB, err := leveldb.OpenFile(filepath.Join(dir, "stateLeveldb"), nil)
+	assert.NoError(t, err)
+	defer stateDB.Close()
+	assert.NoError(t, stateDB.Put(format.FormatKey, []byte("2.0"), nil))
+	put := func(ns, key string, value []byte) {
+		v, err := utils.EncodeValue(&statedb.VersionedValue{Value: value, Version: version.NewHeight(1, 0)})
+		assert.NoError(t, err)
+		assert.NoError(t, stateDB.Put([]byte("mychannel\x00d"+ns+"\x00"+key), v, nil))
+	}
+	hash := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return string(h[:])
+	}
+	put("mycc$$pcoll2", "secret", []byte("value"))
+	put("mycc$$hcoll1", hash("k"), []byte("value hash"))
+	put("mycc$$hcoll2", hash("secret"), []byte("value hash"))
+	put("mycc$$hcoll3", hash("unknown"), []byte("value hash"))
+	put("mycc", "public", []byte("value"))
+
+	r := NewResolver()
+	assert.NoError(t, r.AddStateDB(stateDB, "mychannel"))
+	assert.Equal(t, 1, r.Len())
+	assert.NoError(t, r.AddPvtdataStore(pvtdataDB, "mychannel"))
+	assert.Equal(t, 2, r.Len())
+	key, ok := r.Resolve("mycc", "coll1", []byte(hash("k")))
+	assert.True(t, ok)
+	assert.Equal(t, "k", key)
+	_, ok = r.Resolve("mycc", "coll2", []byte(hash("k")))
+	assert.False(t, ok)
+
+	report, err := r.Annotate(stateDB, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"mycc/coll1/" + hex.EncodeToString([]byte(hash("k"))) + ": k",
+		"mycc/coll2/" + hex.EncodeToString([]byte(hash("secret"))) + ": secret",
+	}, []string{report.Resolved[0].String(), report.Resolved[1].String()})
+	assert.Len(t, report.Unresolved, 1)
+	assert.Equal(t, "mycc/coll3/"+hex.EncodeToString([]byte(hash("unknown")))+": no preimage", report.Unresolved[0].String())
+	assert.Equal(t, map[string]int{"mycc/coll3": 1}, report.Unknown())
+}
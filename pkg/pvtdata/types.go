@@ -97,6 +97,24 @@ func (kv PvtDataKV) Location() (uint64, uint64, error) {
 
 }
 
+// Namespace returns the chaincode and collection of the private data
+func (kv PvtDataKV) Namespace() (string, string, error) {
+	internalKey := bytes.SplitN(kv.key, []byte{0x00}, 2)[1]
+	_, n, err := util.DecodeOrderPreservingVarUint64(internalKey[1:])
+	if err != nil {
+		return "", "", err
+	}
+	_, m, err := util.DecodeOrderPreservingVarUint64(internalKey[1+n:])
+	if err != nil {
+		return "", "", err
+	}
+	nsColl := bytes.SplitN(internalKey[1+n+m:], []byte{0x00}, 2)
+	if len(nsColl) != 2 {
+		return "", "", fmt.Errorf("invalid private data key [%x]", kv.key)
+	}
+	return string(nsColl[0]), string(nsColl[1]), nil
+}
+
 func (kv PvtDataKV) Print() {
 	bNum, txNum, err := kv.Location()
 	if err != nil {
@@ -220,6 +238,26 @@ func (kv IneligibleMissingDataKV) Location() (uint64, uint64, error) {
 	return blkNum, 0, nil
 }
 
+// decode returns the block number, namespace and collection of the entry:
+// <ns>\x00<coll>\x00<reverse order block number>, the block number may contain nil bytes
+func (kv IneligibleMissingDataKV) decode() (uint64, string, string, error) {
+	internalKey := bytes.SplitN(kv.key, []byte{0x00}, 2)[1]
+	if len(internalKey) < 2 {
+		return 0, "", "", fmt.Errorf("invalid ineligible missing data key [%x]", kv.key)
+	}
+	nsCollBlk := bytes.SplitN(internalKey[1:], []byte{0x00}, 3)
+	if len(nsCollBlk) != 3 {
+		return 0, "", "", fmt.Errorf("invalid ineligible missing data key [%x]", kv.key)
+	}
+	blkNum, _ := DecodeReverseOrderVarUint64(nsCollBlk[2])
+	return blkNum, string(nsCollBlk[0]), string(nsCollBlk[1]), nil
+}
+
+// TxNums returns the numbers of the transactions whose private data the peer is not eligible for
+func (kv IneligibleMissingDataKV) TxNums() ([]uint64, error) {
+	return EligibleMissingDataKV{kv.key, kv.value}.TxNums()
+}
+
 func (kv IneligibleMissingDataKV) Type() int {
 	return int(IneligibleMissingDataKeyGroup)
 }
@@ -228,6 +266,93 @@ func (kv IneligibleMissingDataKV) Value() []byte {
 	return kv.value
 }
 
+// EligibleMissingDataKV records the private data of a block a peer is eligible for but has not received.
+// Prioritized entries use prefix 4, deprioritized ones (v2.2+) prefix 8.
+type EligibleMissingDataKV struct {
+	key   []byte
+	value []byte
+}
+
+func (kv EligibleMissingDataKV) Describe() string {
+	return "eligible missing data"
+}
+
+func (kv EligibleMissingDataKV) Key() []byte {
+	return kv.key
+}
+
+// decode returns the block number, namespace and collection of the entry
+func (kv EligibleMissingDataKV) decode() (uint64, string, string, error) {
+	internalKey := bytes.SplitN(kv.key, []byte{0x00}, 2)[1]
+	if len(internalKey) < 2 {
+		return 0, "", "", fmt.Errorf("invalid eligible missing data key [%x]", kv.key)
+	}
+	blkNum, n := DecodeReverseOrderVarUint64(internalKey[1:])
+	nsColl := bytes.SplitN(internalKey[1+n:], []byte{0x00}, 2)
+	if len(nsColl) != 2 {
+		return 0, "", "", fmt.Errorf("invalid eligible missing data key [%x]", kv.key)
+	}
+	return blkNum, string(nsColl[0]), string(nsColl[1]), nil
+}
+
+// Namespace returns the chaincode and collection of the missing data
+func (kv EligibleMissingDataKV) Namespace() (string, string, error) {
+	_, ns, coll, err := kv.decode()
+	return ns, coll, err
+}
+
+// TxNums returns the numbers of the transactions whose private data is missing
+func (kv EligibleMissingDataKV) TxNums() ([]uint64, error) {
+	b := &bitset.BitSet{}
+	if err := b.UnmarshalBinary(kv.value); err != nil {
+		return nil, err
+	}
+	txNums := []uint64{}
+	for i, ok := b.NextSet(0); ok; i, ok = b.NextSet(i + 1) {
+		txNums = append(txNums, uint64(i))
+	}
+	return txNums, nil
+}
+
+func (kv EligibleMissingDataKV) Print() {
+	blkNum, ns, coll, err := kv.decode()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	txNums, err := kv.TxNums()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	channel := bytes.SplitN(kv.key, []byte{0x00}, 2)[0]
+
+	// build key message
+	msgKey := fmt.Sprintf("\tchannel: %s\n", channel)
+	msgKey += fmt.Sprintf("\tchaincode: %s\n", ns)
+	msgKey += fmt.Sprintf("\tBlockNum: %d\n", blkNum)
+	msgKey += fmt.Sprintf("\tcollectionName: %s\n", coll)
+
+	// build message
+	msg := fmt.Sprintf("<EligibleMissingDataKV>\n")
+	msg += fmt.Sprintf("key:\n%s", msgKey)
+	msg += fmt.Sprintf("value: txNums %v\n", txNums)
+	fmt.Println(msg)
+}
+
+func (kv EligibleMissingDataKV) Location() (uint64, uint64, error) {
+	blkNum, _, _, err := kv.decode()
+	return blkNum, 0, err
+}
+
+func (kv EligibleMissingDataKV) Type() int {
+	return int(bytes.SplitN(kv.key, []byte{0x00}, 2)[1][0])
+}
+
+func (kv EligibleMissingDataKV) Value() []byte {
+	return kv.value
+}
+
 // encodeReverseOrderVarUint64 returns a byte-representation for a uint64 number such that
 // the number is first subtracted from MaxUint64 and then all the leading 0xff bytes
 // are trimmed and replaced by the number of such trimmed bytes. This helps in reducing the size.
@@ -0,0 +1,230 @@
+package pvtdata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	goproto "github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/block"
+)
+
+const (
+	// HashMismatch: the stored private rwset does not hash to PvtRwSetHash of the block
+	HashMismatch = iota
+	// Orphan: private data is stored for a collection no valid transaction of the block wrote
+	Orphan
+	// MissingEligible: the block references private data the peer is eligible for but does not hold
+	MissingEligible
+	// Unaccounted: the block references private data that is neither stored nor recorded as missing,
+	// e.g. because it expired (block-to-live) and was purged
+	Unaccounted
+)
+
+var findingNames = map[int]string{
+	HashMismatch:    "HASH_MISMATCH",
+	Orphan:          "ORPHAN",
+	MissingEligible: "MISSING_ELIGIBLE",
+	Unaccounted:     "UNACCOUNTED",
+}
+
+// Finding is a single private data integrity problem
+type Finding struct {
+	Kind       int
+	BlockNum   uint64
+	TxNum      uint64
+	Namespace  string
+	Collection string
+	Detail     string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("[%s] block %d tx %d %s/%s: %s", findingNames[f.Kind], f.BlockNum, f.TxNum, f.Namespace, f.Collection, f.Detail)
+}
+
+// VerifyReport is the result of cross-checking the pvtdataStore of a channel with its blocks
+type VerifyReport struct {
+	Channel    string
+	Checked    int // private rwsets compared with their block hash
+	Matched    int
+	Ineligible int // block references to data the peer is not eligible for
+	Findings   []Finding
+}
+
+// OK reports whether no problem was found
+func (r *VerifyReport) OK() bool {
+	return len(r.Findings) == 0
+}
+
+type pvtLocation struct {
+	blkNum, txNum uint64
+	ns, coll      string
+}
+
+// Verify hashes every private rwset of the channel stored in the pvtdataStore db and
+// compares it with the PvtRwSetHash of the collection in the block. Blocks are read
+// from the ledger in order, so only the hashes of the stored rwsets are held in memory.
+func Verify(db *leveldb.DB, ledger *block.Ledger, channel string) (*VerifyReport, error) {
+	stored, err := storedHashes(db, channel)
+	if err != nil {
+		return nil, err
+	}
+	eligible, ineligible, err := missingData(db, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &VerifyReport{Channel: channel}
+	err = ledger.WalkBlocks(channel, func(b block.Block) error {
+		txs, err := block.GetTransactions(b.GetBlock())
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			if !tx.IsValid() || tx.RWSet == nil {
+				continue
+			}
+			for _, nsRwSet := range tx.RWSet.NsRwSets {
+				for _, coll := range nsRwSet.CollHashedRwSets {
+					loc := pvtLocation{tx.BlockNum, tx.TxNum, nsRwSet.NameSpace, coll.CollectionName}
+					r.check(loc, coll.PvtRwSetHash, stored, eligible, ineligible)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := make([]pvtLocation, 0, len(stored))
+	for loc := range stored {
+		orphans = append(orphans, loc)
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].less(orphans[j]) })
+	for _, loc := range orphans {
+		r.Findings = append(r.Findings, loc.finding(Orphan, "no valid transaction of the block references the private data"))
+	}
+	return r, nil
+}
+
+func (r *VerifyReport) check(loc pvtLocation, expected []byte, stored map[pvtLocation][]byte, eligible, ineligible map[pvtLocation]bool) {
+	actual, ok := stored[loc]
+	if ok {
+		delete(stored, loc)
+		r.Checked++
+		if bytes.Equal(actual, expected) {
+			r.Matched++
+		} else {
+			r.Findings = append(r.Findings, loc.finding(HashMismatch, fmt.Sprintf("expected %x, actual %x", expected, actual)))
+		}
+		return
+	}
+
+	switch {
+	case eligible[loc]:
+		r.Findings = append(r.Findings, loc.finding(MissingEligible, "recorded as eligible missing data"))
+	case ineligible[loc]:
+		r.Ineligible++
+	default:
+		r.Findings = append(r.Findings, loc.finding(Unaccounted, "neither stored nor recorded as missing"))
+	}
+}
+
+func (l pvtLocation) finding(kind int, detail string) Finding {
+	return Finding{kind, l.blkNum, l.txNum, l.ns, l.coll, detail}
+}
+
+func (l pvtLocation) less(o pvtLocation) bool {
+	if l.blkNum != o.blkNum {
+		return l.blkNum < o.blkNum
+	}
+	if l.txNum != o.txNum {
+		return l.txNum < o.txNum
+	}
+	if l.ns != o.ns {
+		return l.ns < o.ns
+	}
+	return l.coll < o.coll
+}
+
+func prefixRange(channel string, prefix byte) *lutil.Range {
+	return lutil.BytesPrefix(append([]byte(channel), 0x00, prefix))
+}
+
+// storedHashes returns the hash of every private rwset stored for the channel
+func storedHashes(db *leveldb.DB, channel string) (map[pvtLocation][]byte, error) {
+	hashes := map[pvtLocation][]byte{}
+	iter := db.NewIterator(prefixRange(channel, PvtDataKeyPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv := PvtDataKV{iter.Key(), iter.Value()}
+		blkNum, txNum, err := kv.Location()
+		if err != nil {
+			return nil, err
+		}
+		ns, coll, err := kv.Namespace()
+		if err != nil {
+			return nil, err
+		}
+		collPvtdata := &rwset.CollectionPvtReadWriteSet{}
+		if err := goproto.Unmarshal(iter.Value(), collPvtdata); err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(collPvtdata.Rwset)
+		hashes[pvtLocation{blkNum, txNum, ns, coll}] = hash[:]
+	}
+	return hashes, iter.Error()
+}
+
+// missingData returns the transactions recorded as eligible and as ineligible missing data,
+// both decoded from the bitset of transaction numbers of their block collection entry
+func missingData(db *leveldb.DB, channel string) (map[pvtLocation]bool, map[pvtLocation]bool, error) {
+	eligible := map[pvtLocation]bool{}
+	for _, prefix := range []byte{EligiblePrioritizedMissingDataGroup, EligibleDeprioritizedMissingDataGroup} {
+		iter := db.NewIterator(prefixRange(channel, prefix), nil)
+		for iter.Next() {
+			kv := EligibleMissingDataKV{iter.Key(), iter.Value()}
+			blkNum, ns, coll, err := kv.decode()
+			if err != nil {
+				iter.Release()
+				return nil, nil, err
+			}
+			txNums, err := kv.TxNums()
+			if err != nil {
+				iter.Release()
+				return nil, nil, err
+			}
+			for _, txNum := range txNums {
+				eligible[pvtLocation{blkNum, txNum, ns, coll}] = true
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ineligible := map[pvtLocation]bool{}
+	iter := db.NewIterator(prefixRange(channel, IneligibleMissingDataKeyGroup), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv := IneligibleMissingDataKV{iter.Key(), iter.Value()}
+		blkNum, ns, coll, err := kv.decode()
+		if err != nil {
+			return nil, nil, err
+		}
+		txNums, err := kv.TxNums()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, txNum := range txNums {
+			ineligible[pvtLocation{blkNum, txNum, ns, coll}] = true
+		}
+	}
+	return eligible, ineligible, iter.Error()
+}
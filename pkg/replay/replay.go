@@ -0,0 +1,405 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+const (
+	// the peer stores the channel config under this key of the empty namespace
+	peerNamespace    = ""
+	channelConfigKey = "CHANNEL_CONFIG_ENV_BYTES"
+)
+
+// stateKey identifies a public key (coll == "") or a hashed private key
+type stateKey struct {
+	ns, coll, key string
+}
+
+func (k stateKey) String() string {
+	if k.coll == "" {
+		return fmt.Sprintf("%s/%s", k.ns, k.key)
+	}
+	return fmt.Sprintf("%s/%s/%s", k.ns, k.coll, hex.EncodeToString([]byte(k.key)))
+}
+
+// expectedValue keeps the hash of the value only, the replayed state of a long chain may hold millions of keys.
+// The value itself is kept by a value replayer.
+type expectedValue struct {
+	valueHash [32]byte
+	metadata  map[string][]byte
+	version   *version.Height
+	value     []byte
+}
+
+// Replayer computes the world state a peer should hold by applying the write sets of the valid transactions in order
+type Replayer struct {
+	state      map[stateKey]*expectedValue
+	lastBlock  *uint64
+	keepValues bool
+	namespaces map[string]bool // nil for all namespaces
+}
+
+// NewReplayer returns a Replayer on an empty world state
+func NewReplayer() *Replayer {
+	return &Replayer{state: map[stateKey]*expectedValue{}}
+}
+
+// NewValueReplayer returns a Replayer that keeps the values of the keys, so that Records can
+// return them. When namespaces are given, the other namespaces are not tracked.
+func NewValueReplayer(namespaces ...string) *Replayer {
+	r := &Replayer{state: map[stateKey]*expectedValue{}, keepValues: true}
+	if len(namespaces) != 0 {
+		r.namespaces = map[string]bool{}
+		for _, ns := range namespaces {
+			r.namespaces[ns] = true
+		}
+	}
+	return r
+}
+
+// Replay applies all blocks of the channel
+func Replay(ledger *block.Ledger, channel string) (*Replayer, error) {
+	r := NewReplayer()
+	if err := ledger.WalkBlocks(channel, r.AddBlock); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LastBlock returns the number of the last block applied, false when none was
+func (r *Replayer) LastBlock() (uint64, bool) {
+	if r.lastBlock == nil {
+		return 0, false
+	}
+	return *r.lastBlock, true
+}
+
+// Len returns the number of keys of the replayed state
+func (r *Replayer) Len() int {
+	return len(r.state)
+}
+
+// AddBlock applies the writes of the valid transactions of the next block.
+// Config transactions store the config envelope like the peer's config tx processor does.
+func (r *Replayer) AddBlock(b block.Block) error {
+	cb := b.GetBlock()
+	blockNum := cb.GetHeader().GetNumber()
+	if r.lastBlock != nil && blockNum != *r.lastBlock+1 {
+		return fmt.Errorf("expected block [%d], got block [%d]", *r.lastBlock+1, blockNum)
+	}
+	txs, err := block.GetTransactions(cb)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if !tx.IsValid() {
+			continue
+		}
+		height := version.NewHeight(tx.BlockNum, tx.TxNum)
+		switch tx.Type {
+		case common.HeaderType_CONFIG:
+			env, err := protoutil.GetEnvelopeFromBlock(cb.Data.Data[tx.TxNum])
+			if err != nil {
+				return err
+			}
+			payload, err := protoutil.UnmarshalPayload(env.Payload)
+			if err != nil {
+				return err
+			}
+			r.put(stateKey{peerNamespace, "", channelConfigKey}, payload.Data, nil, height)
+		case common.HeaderType_ENDORSER_TRANSACTION:
+			if tx.RWSet != nil {
+				if err := r.applyTxRwSet(tx.RWSet, height); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	r.lastBlock = &blockNum
+	return nil
+}
+
+// keyOps collects the operations of a transaction on a key
+type keyOps struct {
+	upsert, delete                 bool
+	metadataUpdate, metadataDelete bool
+	value                          []byte
+	metadata                       map[string][]byte
+}
+
+// applyTxRwSet follows the validator of the peer: a value write keeps the existing metadata
+// unless the transaction also writes metadata, a metadata write keeps the existing value,
+// and a delete removes the key whatever else the transaction did
+func (r *Replayer) applyTxRwSet(txRwSet *rwsetutil.TxRwSet, height *version.Height) error {
+	ops := map[stateKey]*keyOps{}
+	get := func(k stateKey) *keyOps {
+		if ops[k] == nil {
+			ops[k] = &keyOps{}
+		}
+		return ops[k]
+	}
+	write := func(k stateKey, value []byte, isDelete bool) {
+		o := get(k)
+		if isDelete {
+			o.delete = true
+			return
+		}
+		o.upsert, o.value = true, value
+	}
+	writeMetadata := func(k stateKey, entries []*kvrwset.KVMetadataEntry) {
+		o := get(k)
+		if entries == nil {
+			o.metadataDelete = true
+			return
+		}
+		o.metadataUpdate, o.metadata = true, map[string][]byte{}
+		for _, e := range entries {
+			o.metadata[e.Name] = e.Value
+		}
+	}
+
+	for _, nsRwSet := range txRwSet.NsRwSets {
+		ns := nsRwSet.NameSpace
+		if kvRwSet := nsRwSet.KvRwSet; kvRwSet != nil {
+			for _, w := range kvRwSet.Writes {
+				write(stateKey{ns, "", w.Key}, w.Value, w.IsDelete)
+			}
+			for _, mw := range kvRwSet.MetadataWrites {
+				writeMetadata(stateKey{ns, "", mw.Key}, mw.Entries)
+			}
+		}
+		for _, coll := range nsRwSet.CollHashedRwSets {
+			if coll.HashedRwSet == nil {
+				continue
+			}
+			for _, w := range coll.HashedRwSet.HashedWrites {
+				write(stateKey{ns, coll.CollectionName, string(w.KeyHash)}, w.ValueHash, w.IsDelete)
+			}
+			for _, mw := range coll.HashedRwSet.MetadataWrites {
+				writeMetadata(stateKey{ns, coll.CollectionName, string(mw.KeyHash)}, mw.Entries)
+			}
+		}
+	}
+
+	for k, o := range ops {
+		existing := r.state[k]
+		switch {
+		case o.delete:
+			delete(r.state, k)
+		case o.upsert:
+			metadata := o.metadata
+			if !o.metadataUpdate && !o.metadataDelete && existing != nil {
+				metadata = existing.metadata
+			}
+			r.put(k, o.value, metadata, height)
+		case existing != nil: // metadata only
+			r.state[k] = &expectedValue{existing.valueHash, o.metadata, height, existing.value}
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) put(k stateKey, value []byte, metadata map[string][]byte, height *version.Height) {
+	if r.namespaces != nil && !r.namespaces[k.ns] {
+		return
+	}
+	v := &expectedValue{valueHash: sha256.Sum256(value), metadata: metadata, version: height}
+	if r.keepValues {
+		v.value = value
+	}
+	r.state[k] = v
+}
+
+// Records returns the replayed state of the channel sorted by namespace, collection and key.
+// Private data appears as hashes, the cleartext is not on the chain.
+func (r *Replayer) Records(channel string) ([]*state.Record, error) {
+	if !r.keepValues {
+		return nil, fmt.Errorf("the replayer does not keep values")
+	}
+	records := make([]*state.Record, 0, len(r.state))
+	for k, v := range r.state {
+		record := &state.Record{
+			Channel:    channel,
+			Namespace:  k.ns,
+			Collection: k.coll,
+			Hashed:     k.coll != "",
+			Key:        k.key,
+			Value:      v.value,
+			Version:    v.version,
+			Metadata:   v.metadata,
+		}
+		if !record.Hashed {
+			record.Composite, _ = state.SplitCompositeKey(k.key)
+		}
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func sortRecords(records []*state.Record) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.Key < b.Key
+	})
+}
+
+// Diff is a key whose state differs between the chain and the state db
+type Diff struct {
+	Namespace  string
+	Collection string // set for hashed private data, Key is then the hex encoded key hash
+	Key        string
+	Detail     string
+}
+
+func (d Diff) String() string {
+	if d.Collection == "" {
+		return fmt.Sprintf("%s/%s: %s", d.Namespace, d.Key, d.Detail)
+	}
+	return fmt.Sprintf("%s/%s/%s: %s", d.Namespace, d.Collection, d.Key, d.Detail)
+}
+
+// Report is the result of comparing a replayed state with a stateLeveldb
+type Report struct {
+	Channel        string
+	LastBlock      uint64          // last block replayed
+	SavePoint      *version.Height // savepoint of the state db, nil if absent
+	Expected       int             // keys of the replayed state
+	Matched        int
+	SkippedPrivate int    // cleartext private data is not on the chain and is not compared
+	Missing        []Diff // expected keys absent from the state db
+	Extra          []Diff // keys of the state db no transaction wrote
+	Mismatched     []Diff // keys with a different value, version or metadata
+}
+
+// OK reports whether the state db matches the chain
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// Diff compares the replayed state with the entries of the channel in a stateLeveldb.
+// Hashed private data purged after its block-to-live shows up as missing.
+func (r *Replayer) Diff(db *leveldb.DB, channel string) (*Report, error) {
+	f, err := format.Detect(db)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Channel: channel, Expected: len(r.state)}
+	report.LastBlock, _ = r.LastBlock()
+
+	seen := map[stateKey]bool{}
+	iter := db.NewIterator(lutil.BytesPrefix(append([]byte(channel), 0x00)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := state.ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return nil, err
+		}
+		if kv == nil {
+			continue
+		}
+		record, err := kv.Decode()
+		if err != nil {
+			return nil, err
+		}
+		switch kv.Type() {
+		case state.SavePoint:
+			report.SavePoint = record.Version
+			continue
+		case state.FormatVersion:
+			continue
+		}
+		if record.Collection != "" && !record.Hashed {
+			report.SkippedPrivate++
+			continue
+		}
+
+		k := stateKey{record.Namespace, record.Collection, record.Key}
+		diff := newDiff(k)
+		expected, ok := r.state[k]
+		if !ok {
+			diff.Detail = fmt.Sprintf("not written by any valid transaction, version %s", record.Version)
+			report.Extra = append(report.Extra, diff)
+			continue
+		}
+		seen[k] = true
+		if detail := expected.compare(record); detail != "" {
+			diff.Detail = detail
+			report.Mismatched = append(report.Mismatched, diff)
+			continue
+		}
+		report.Matched++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.state {
+		if !seen[k] {
+			diff := newDiff(k)
+			diff.Detail = fmt.Sprintf("written at version %s", v.version)
+			report.Missing = append(report.Missing, diff)
+		}
+	}
+	sortDiffs(report.Missing)
+	return report, nil
+}
+
+func newDiff(k stateKey) Diff {
+	if k.coll == "" {
+		return Diff{Namespace: k.ns, Key: k.key}
+	}
+	return Diff{Namespace: k.ns, Collection: k.coll, Key: hex.EncodeToString([]byte(k.key))}
+}
+
+func (v *expectedValue) compare(record *state.Record) string {
+	if v.version.Compare(record.Version) != 0 {
+		return fmt.Sprintf("version %s, expected %s", record.Version, v.version)
+	}
+	if sha256.Sum256(record.Value) != v.valueHash {
+		return "value differs"
+	}
+	if len(v.metadata) != len(record.Metadata) {
+		return "metadata differs"
+	}
+	for name, value := range v.metadata {
+		if !bytes.Equal(value, record.Metadata[name]) {
+			return fmt.Sprintf("metadata [%s] differs", name)
+		}
+	}
+	return ""
+}
+
+func sortDiffs(diffs []Diff) {
+	sort.Slice(diffs, func(i, j int) bool {
+		a, b := diffs[i], diffs[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.Key < b.Key
+	})
+}
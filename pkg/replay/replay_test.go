@@ -0,0 +1,251 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/common/ledger/util"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/the-medium/ledger-parser/internal/testutil"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/index"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+var ts = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func tx(txID string, code peer.TxValidationCode, kvRwSet *kvrwset.KVRWSet, colls ...*rwsetutil.CollHashedRwSet) *testutil.Tx {
+	return &testutil.Tx{
+		TxID: txID, ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts,
+		MSPID: "Org1MSP", Chaincode: "mycc", ValidationCode: code,
+		RWSet: &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{{NameSpace: "mycc", KvRwSet: kvRwSet, CollHashedRwSets: colls}}},
+	}
+}
+
+func putValue(t *testing.T, db *leveldb.DB, key string, value []byte, height *version.Height, metadata []*kvrwset.KVMetadataEntry) {
+	metadataBytes, err := utils.Serialize(metadata)
+	assert.NoError(t, err)
+	if metadata == nil {
+		metadataBytes = nil
+	}
+	v, err := utils.EncodeValue(&statedb.VersionedValue{Value: value, Version: height, Metadata: metadataBytes})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("mychannel\x00d"+key), v, nil))
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policy := []*kvrwset.KVMetadataEntry{{Name: "VALIDATION_PARAMETER", Value: []byte("policy")}}
+	keyHash, valueHash := sha256.Sum256([]byte("secret")), sha256.Sum256([]byte("value"))
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{{TxID: "config", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts, Data: []byte("config envelope")}},
+		[]*testutil.Tx{
+			tx("tx1", peer.TxValidationCode_VALID, &kvrwset.KVRWSet{
+				Writes:         []*kvrwset.KVWrite{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}, {Key: "c", Value: []byte("3")}},
+				MetadataWrites: []*kvrwset.KVMetadataWrite{{Key: "a", Entries: policy}},
+			}, &rwsetutil.CollHashedRwSet{CollectionName: "coll1", HashedRwSet: &kvrwset.HashedRWSet{
+				HashedWrites: []*kvrwset.KVWriteHash{{KeyHash: keyHash[:], ValueHash: valueHash[:]}},
+			}}),
+			tx("tx2", peer.TxValidationCode_MVCC_READ_CONFLICT, &kvrwset.KVRWSet{
+				Writes: []*kvrwset.KVWrite{{Key: "a", Value: []byte("invalid")}},
+			}),
+		},
+		[]*testutil.Tx{
+			tx("tx3", peer.TxValidationCode_VALID, &kvrwset.KVRWSet{
+				Writes: []*kvrwset.KVWrite{{Key: "a", Value: []byte("10")}, {Key: "b", IsDelete: true}},
+			}),
+			tx("tx4", peer.TxValidationCode_VALID, &kvrwset.KVRWSet{
+				MetadataWrites: []*kvrwset.KVMetadataWrite{{Key: "c", Entries: policy}, {Key: "nokey", Entries: policy}},
+			}),
+		},
+	)
+	assert.NoError(t, err)
+	base := filepath.Join(dir, "ledgersData", "chains")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(base, "chains"), filepath.Join(base, "index"), "mychannel", true, blocks...))
+	ledger, err := block.OpenLedger(dir)
+	assert.NoError(t, err)
+
+	r, err := Replay(ledger, "mychannel")
+	assert.NoError(t, err)
+	last, ok := r.LastBlock()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), last)
+	// config, a, c and the hashed key
+	assert.Equal(t, 4, r.Len())
+
+	db, err := leveldb.OpenFile(filepath.Join(dir, "stateLeveldb"), nil)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00s"), version.NewHeight(2, 1).ToBytes(), nil))
+	putValue(t, db, "\x00CHANNEL_CONFIG_ENV_BYTES", []byte("config envelope"), version.NewHeight(0, 0), nil)
+	putValue(t, db, "mycc\x00a", []byte("10"), version.NewHeight(2, 0), policy)
+	putValue(t, db, "mycc$$hcoll1\x00"+string(keyHash[:]), valueHash[:], version.NewHeight(1, 0), nil)
+	putValue(t, db, "mycc$$pcoll1\x00secret", []byte("value"), version.NewHeight(1, 0), nil)
+
+	report, err := r.Diff(db, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, []Diff{{Namespace: "mycc", Key: "c", Detail: "written at version {BlockNum: 2, TxNum: 1}"}}, report.Missing)
+	assert.Empty(t, report.Extra)
+	assert.Empty(t, report.Mismatched)
+	assert.Equal(t, 3, report.Matched)
+	assert.Equal(t, 1, report.SkippedPrivate)
+	assert.Equal(t, version.NewHeight(2, 1), report.SavePoint)
+
+	// drift: c with the metadata lost, b restored from an old backup
+	putValue(t, db, "mycc\x00c", []byte("3"), version.NewHeight(2, 1), nil)
+	putValue(t, db, "mycc\x00b", []byte("2"), version.NewHeight(1, 0), nil)
+	report, err = r.Diff(db, "mychannel")
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Empty(t, report.Missing)
+	assert.Equal(t, []Diff{{Namespace: "mycc", Key: "b", Detail: "not written by any valid transaction, version {BlockNum: 1, TxNum: 0}"}}, report.Extra)
+	assert.Equal(t, []Diff{{Namespace: "mycc", Key: "c", Detail: "metadata differs"}}, report.Mismatched)
+}
+
+func putHistory(t *testing.T, db *leveldb.DB, key string, blockNum, txNum uint64) {
+	k := append([]byte("mychannel\x00mycc\x00"), util.EncodeOrderPreservingVarUint64(uint64(len(key)))...)
+	k = append(append(k, key...), 0x00)
+	k = append(k, version.NewHeight(blockNum, txNum).ToBytes()...)
+	assert.NoError(t, db.Put(k, []byte{}, nil))
+}
+
+func TestStateAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stateat")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policy := []*kvrwset.KVMetadataEntry{{Name: "VALIDATION_PARAMETER", Value: []byte("policy")}}
+	composite := "\x00asset\x00a1\x00"
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{{TxID: "config", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts, Data: []byte("config envelope")}},
+		[]*testutil.Tx{
+			tx("tx1", peer.TxValidationCode_VALID, &kvrwset.KVRWSet{
+				Writes:         []*kvrwset.KVWrite{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte{0xff}}, {Key: composite, Value: []byte("x")}},
+				MetadataWrites: []*kvrwset.KVMetadataWrite{{Key: "a", Entries: policy}},
+			}),
+		},
+		[]*testutil.Tx{
+			tx("tx2", peer.TxValidationCode_VALID, &kvrwset.KVRWSet{
+				Writes: []*kvrwset.KVWrite{{Key: "a", Value: []byte("10")}, {Key: "b", IsDelete: true}},
+			}),
+			tx("tx3", peer.TxValidationCode_VALID, &kvrwset.KVRWSet{
+				Writes: []*kvrwset.KVWrite{{Key: "c", Value: []byte("3")}},
+			}),
+		},
+	)
+	assert.NoError(t, err)
+	base := filepath.Join(dir, "ledgersData", "chains")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(base, "chains"), filepath.Join(base, "index"), "mychannel", true, blocks...))
+	ledger, err := block.OpenLedger(dir)
+	assert.NoError(t, err)
+
+	atBlock1 := []*state.Record{
+		{Channel: "mychannel", Namespace: "mycc", Key: composite, Composite: &state.CompositeKey{ObjectType: "asset", Attributes: []string{"a1"}}, Value: []byte("x"), Version: version.NewHeight(1, 0)},
+		{Channel: "mychannel", Namespace: "mycc", Key: "a", Value: []byte("1"), Version: version.NewHeight(1, 0), Metadata: map[string][]byte{"VALIDATION_PARAMETER": []byte("policy")}},
+		{Channel: "mychannel", Namespace: "mycc", Key: "b", Value: []byte{0xff}, Version: version.NewHeight(1, 0)},
+	}
+	records, err := StateAt(ledger, "mychannel", "mycc", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, atBlock1, records)
+
+	records, err = StateAt(ledger, "mychannel", "mycc", 2)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, []byte("10"), records[1].Value)
+	assert.Equal(t, map[string][]byte{"VALIDATION_PARAMETER": []byte("policy")}, records[1].Metadata)
+	assert.Equal(t, "c", records[2].Key)
+
+	_, err = StateAt(ledger, "mychannel", "mycc", 3)
+	assert.EqualError(t, err, "channel [mychannel] has no block [3]")
+
+	// a ledger bootstrapped from a snapshot at block 1 cannot be replayed
+	snapshotDir := filepath.Join(dir, "snapshot")
+	snapshotBase := filepath.Join(snapshotDir, "ledgersData", "chains")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(snapshotBase, "chains"), filepath.Join(snapshotBase, "index"), "mychannel", true, blocks[2:]...))
+	snapshotLedger, err := block.OpenLedger(snapshotDir)
+	assert.NoError(t, err)
+	_, err = StateAt(snapshotLedger, "mychannel", "mycc", 2)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "start at block [2]")
+
+	// the current state at block 2 and the history index
+	stateDB, err := leveldb.OpenFile(filepath.Join(dir, "stateLeveldb"), nil)
+	assert.NoError(t, err)
+	defer stateDB.Close()
+	assert.NoError(t, stateDB.Put(format.FormatKey, []byte("2.0"), nil))
+	putValue(t, stateDB, "mycc\x00"+composite, []byte("x"), version.NewHeight(1, 0), nil)
+	putValue(t, stateDB, "mycc\x00a", []byte("10"), version.NewHeight(2, 0), policy)
+	putValue(t, stateDB, "mycc\x00c", []byte("3"), version.NewHeight(2, 1), nil)
+	putValue(t, stateDB, "mycc2\x00z", []byte("other namespace"), version.NewHeight(2, 1), nil)
+
+	historyDB, err := leveldb.OpenFile(filepath.Join(dir, "historyLeveldb"), nil)
+	assert.NoError(t, err)
+	defer historyDB.Close()
+	assert.NoError(t, historyDB.Put(format.FormatKey, []byte("2.0"), nil))
+	putHistory(t, historyDB, "a", 1, 0)
+	putHistory(t, historyDB, "a", 2, 0)
+	putHistory(t, historyDB, "b", 1, 0)
+	putHistory(t, historyDB, "b", 2, 0)
+	putHistory(t, historyDB, "c", 2, 1)
+	putHistory(t, historyDB, composite, 1, 0)
+
+	indexDB, err := leveldb.OpenFile(filepath.Join(base, "index"), nil)
+	assert.NoError(t, err)
+	store, err := index.NewBlockStore(ledger, indexDB)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	reader, err := state.NewStateReader(stateDB)
+	assert.NoError(t, err)
+	records, err = StateAtFromHistory(reader, historyDB, store, "mychannel", "mycc", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, atBlock1, records)
+
+	// without the current state, the metadata comes from the write set of the transaction
+	records, err = StateAtFromHistory(nil, historyDB, store, "mychannel", "mycc", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, atBlock1, records)
+
+	records, err = StateAtFromHistory(nil, historyDB, store, "mychannel", "mycc", 2)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Nil(t, records[1].Metadata)
+
+	_, err = StateAtFromHistory(nil, historyDB, store, "mychannel", "mycc", 3)
+	assert.EqualError(t, err, "channel [mychannel] has no block [3]")
+
+	// the reconstructed state exports like the current state
+	records, err = StateAt(ledger, "mychannel", "mycc", 2)
+	assert.NoError(t, err)
+	var replayed, current bytes.Buffer
+	assert.NoError(t, state.Export(&replayed, records))
+	assert.NoError(t, state.ExportNamespace(&current, stateDB, "mychannel", "mycc"))
+	assert.Equal(t, current.String(), replayed.String())
+
+	replayed.Reset()
+	assert.NoError(t, state.Export(&replayed, atBlock1))
+	assert.Equal(t, `[
+{"channel":"mychannel","namespace":"mycc","key":"\u0000asset\u0000a1\u0000","composite_key":{"object_type":"asset","attributes":["a1"]},"value":"x","version":{"block_num":1,"tx_num":0}},
+{"channel":"mychannel","namespace":"mycc","key":"a","value":"1","version":{"block_num":1,"tx_num":0},"metadata":{"VALIDATION_PARAMETER":"cG9saWN5"}},
+{"channel":"mychannel","namespace":"mycc","key":"b","value_base64":"/w==","version":{"block_num":1,"tx_num":0}}
+]
+`, replayed.String())
+}
@@ -0,0 +1,171 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/history"
+	"github.com/the-medium/ledger-parser/pkg/index"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+var errStop = errors.New("stop")
+
+// StateAt returns the state of a namespace as of block blockNum, i.e. after the valid
+// transactions of that block were committed, by replaying the chain from the genesis block.
+// A ledger bootstrapped from a snapshot has no blocks before the snapshot, its state at a block
+// is read with StateAtFromHistory or from the snapshot itself.
+func StateAt(ledger *block.Ledger, channel, ns string, blockNum uint64) ([]*state.Record, error) {
+	r := NewValueReplayer(ns)
+	err := ledger.WalkBlocks(channel, func(b block.Block) error {
+		if _, ok := r.LastBlock(); !ok {
+			if first := b.GetBlock().GetHeader().GetNumber(); first != 0 {
+				return fmt.Errorf("the blockfiles of channel [%s] start at block [%d] after a snapshot, use StateAtFromHistory or the snapshot", channel, first)
+			}
+		}
+		if err := r.AddBlock(b); err != nil {
+			return err
+		}
+		if *r.lastBlock == blockNum {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	if last, ok := r.LastBlock(); !ok || last != blockNum {
+		return nil, fmt.Errorf("channel [%s] has no block [%d]", channel, blockNum)
+	}
+	return r.Records(channel)
+}
+
+// StateAtFromHistory returns the public state of a namespace as of block blockNum using the
+// history index instead of replaying the chain: the last write of each key up to the block is
+// read through the block index. When current is not nil, keys unchanged since then are taken
+// from the current state without reading the transaction.
+//
+// The history index records value writes only, so the metadata of a key is known when the
+// key is unchanged since blockNum or the transaction of its last write also wrote its metadata.
+func StateAtFromHistory(current *state.StateReader, historyDB *leveldb.DB, store *index.BlockStore, channel, ns string, blockNum uint64) ([]*state.Record, error) {
+	f, err := format.Detect(historyDB)
+	if err != nil {
+		return nil, err
+	}
+	last, err := store.LastBlockIndexed(channel)
+	if err != nil {
+		return nil, err
+	}
+	if blockNum > last {
+		return nil, fmt.Errorf("channel [%s] has no block [%d]", channel, blockNum)
+	}
+
+	// entries of a key are contiguous and ordered by height, the last one up to blockNum wins
+	heights := map[string]*version.Height{}
+	var keys []string
+	iter := historyDB.NewIterator(lutil.BytesPrefix([]byte(channel+"\x00"+ns+"\x00")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := history.ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return nil, err
+		}
+		general, ok := kv.(*history.GeneralKV)
+		if !ok {
+			continue
+		}
+		hk, err := general.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if hk.Namespace != ns || hk.BlockNum > blockNum {
+			continue
+		}
+		if heights[hk.Key] == nil {
+			keys = append(keys, hk.Key)
+		}
+		heights[hk.Key] = version.NewHeight(hk.BlockNum, hk.TxNum)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	var records []*state.Record
+	for _, key := range keys {
+		record, err := recordAt(current, store, channel, ns, key, heights[key])
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// recordAt returns the key as written at height, nil when the write was a delete
+func recordAt(current *state.StateReader, store *index.BlockStore, channel, ns, key string, height *version.Height) (*state.Record, error) {
+	record := &state.Record{Channel: channel, Namespace: ns, Key: key, Version: height}
+	record.Composite, _ = state.SplitCompositeKey(key)
+
+	if current != nil {
+		vv, err := current.Get(channel, ns, key)
+		if err != nil {
+			return nil, err
+		}
+		if vv != nil && vv.Version.Compare(height) == 0 {
+			if record.Metadata, err = utils.Deserialize(vv.Metadata); err != nil {
+				return nil, err
+			}
+			record.Value = vv.Value
+			return record, nil
+		}
+	}
+
+	env, err := store.RetrieveTxByBlockNumTranNum(channel, height.BlockNum, height.TxNum)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := block.DecodeEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+	if tx.RWSet == nil {
+		return nil, fmt.Errorf("transaction at %s has no write set", height)
+	}
+	found := false
+	for _, nsRwSet := range tx.RWSet.NsRwSets {
+		if nsRwSet.NameSpace != ns || nsRwSet.KvRwSet == nil {
+			continue
+		}
+		for _, w := range nsRwSet.KvRwSet.Writes {
+			if w.Key != key {
+				continue
+			}
+			if w.IsDelete {
+				return nil, nil
+			}
+			record.Value, found = w.Value, true
+		}
+		for _, mw := range nsRwSet.KvRwSet.MetadataWrites {
+			if mw.Key != key {
+				continue
+			}
+			record.Metadata = map[string][]byte{}
+			for _, e := range mw.Entries {
+				record.Metadata[e.Name] = e.Value
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("transaction at %s does not write [%s]", height, key)
+	}
+	return record, nil
+}
@@ -0,0 +1,65 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// fileReader decodes a snapshot data or metadata file. Every file starts with a
+// format byte and is followed by uvarint numbers and length prefixed byte strings.
+type fileReader struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+func openFile(path string, expectedFormat byte) (*fileReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &fileReader{file: file, reader: bufio.NewReader(file)}
+	format, err := r.reader.ReadByte()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error: cannot read the format of [%s], error=[%v]", path, err)
+	}
+	if format != expectedFormat {
+		file.Close()
+		return nil, fmt.Errorf("error: unexpected format [%x] of [%s], expected [%x]", format, path, expectedFormat)
+	}
+	return r, nil
+}
+
+func (r *fileReader) decodeUVarint() (uint64, error) {
+	return binary.ReadUvarint(r.reader)
+}
+
+func (r *fileReader) decodeBytes() ([]byte, error) {
+	size, err := r.decodeUVarint()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *fileReader) decodeString() (string, error) {
+	b, err := r.decodeBytes()
+	return string(b), err
+}
+
+// atEOF reports whether all records have been read
+func (r *fileReader) atEOF() bool {
+	_, err := r.reader.Peek(1)
+	return err == io.EOF
+}
+
+func (r *fileReader) close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,268 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+const (
+	SignableMetadataFileName   = "_snapshot_signable_metadata.json"
+	AdditionalMetadataFileName = "_snapshot_additional_metadata.json"
+
+	TxIDsDataFileName                  = "txids.data"
+	TxIDsMetadataFileName              = "txids.metadata"
+	PublicStateDataFileName            = "public_state.data"
+	PublicStateMetadataFileName        = "public_state.metadata"
+	PrivateStateHashesDataFileName     = "private_state_hashes.data"
+	PrivateStateHashesMetadataFileName = "private_state_hashes.metadata"
+
+	snapshotFileFormat = byte(1)
+	// levelDBValueFormat is the value format of states exported from a goleveldb statedb (VersionedValueProto)
+	levelDBValueFormat = byte(1)
+)
+
+// SignableMetadata is the content of _snapshot_signable_metadata.json
+type SignableMetadata struct {
+	ChannelName            string            `json:"channel_name"`
+	LastBlockNumber        uint64            `json:"last_block_number"`
+	LastBlockHashInHex     string            `json:"last_block_hash"`
+	PreviousBlockHashInHex string            `json:"previous_block_hash"`
+	FilesAndHashes         map[string]string `json:"snapshot_files_raw_hashes"`
+	StateDBType            string            `json:"state_db_type"`
+}
+
+// AdditionalMetadata is the content of _snapshot_additional_metadata.json
+type AdditionalMetadata struct {
+	SnapshotHashInHex        string `json:"snapshot_hash"`
+	LastBlockCommitHashInHex string `json:"last_block_commit_hash"`
+}
+
+// Snapshot is a channel snapshot exported by a Fabric 2.3+ peer
+type Snapshot struct {
+	Dir        string
+	Metadata   *SignableMetadata
+	Additional *AdditionalMetadata // nil when the file is absent
+}
+
+// Open reads the metadata of the snapshot in dir
+func Open(dir string) (*Snapshot, error) {
+	s := &Snapshot{Dir: dir, Metadata: &SignableMetadata{}}
+	b, err := ioutil.ReadFile(filepath.Join(dir, SignableMetadataFileName))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s.Metadata); err != nil {
+		return nil, fmt.Errorf("error: cannot decode [%s], error=[%v]", SignableMetadataFileName, err)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, AdditionalMetadataFileName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		s.Additional = &AdditionalMetadata{}
+		if err := json.Unmarshal(b, s.Additional); err != nil {
+			return nil, fmt.Errorf("error: cannot decode [%s], error=[%v]", AdditionalMetadataFileName, err)
+		}
+	}
+	return s, nil
+}
+
+// HashCheck is the result of verifying the hash of one snapshot file
+type HashCheck struct {
+	File     string
+	Expected string
+	Actual   string
+	Err      error
+}
+
+// OK reports whether the file could be read and matches its expected hash
+func (c HashCheck) OK() bool {
+	return c.Err == nil && c.Expected == c.Actual
+}
+
+func (c HashCheck) String() string {
+	switch {
+	case c.Err != nil:
+		return fmt.Sprintf("%s: %v", c.File, c.Err)
+	case c.OK():
+		return fmt.Sprintf("%s: ok", c.File)
+	default:
+		return fmt.Sprintf("%s: hash mismatch, expected %s, actual %s", c.File, c.Expected, c.Actual)
+	}
+}
+
+// Verify recomputes the SHA256 hash of every file listed in the signable metadata and,
+// when present, the snapshot hash over the signable metadata file itself.
+// The checks are sorted by file name.
+func (s *Snapshot) Verify() []HashCheck {
+	files := make([]string, 0, len(s.Metadata.FilesAndHashes))
+	for file := range s.Metadata.FilesAndHashes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	checks := []HashCheck{}
+	for _, file := range files {
+		actual, err := fileHash(filepath.Join(s.Dir, file))
+		checks = append(checks, HashCheck{file, s.Metadata.FilesAndHashes[file], actual, err})
+	}
+	if s.Additional != nil {
+		actual, err := fileHash(filepath.Join(s.Dir, SignableMetadataFileName))
+		checks = append(checks, HashCheck{SignableMetadataFileName, s.Additional.SnapshotHashInHex, actual, err})
+	}
+	return checks
+}
+
+func fileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// TxIDs calls fn for every transaction id of the snapshot, in the sorted order they are stored
+func (s *Snapshot) TxIDs(fn func(txID string) error) error {
+	count, err := s.readCount(TxIDsMetadataFileName)
+	if err != nil {
+		return err
+	}
+	data, err := openFile(filepath.Join(s.Dir, TxIDsDataFileName), snapshotFileFormat)
+	if err != nil {
+		return err
+	}
+	defer data.close()
+
+	for i := uint64(0); i < count; i++ {
+		txID, err := data.decodeString()
+		if err != nil {
+			return fmt.Errorf("error: cannot read txid [%d] of [%d], error=[%v]", i, count, err)
+		}
+		if err := fn(txID); err != nil {
+			return err
+		}
+	}
+	if !data.atEOF() {
+		return fmt.Errorf("error: [%s] holds more than the [%d] txids recorded in [%s]", TxIDsDataFileName, count, TxIDsMetadataFileName)
+	}
+	return nil
+}
+
+// PublicState calls fn for every public state of the snapshot, decoded as pkg/state does for a stateLeveldb entry
+func (s *Snapshot) PublicState(fn func(state.KVSet) error) error {
+	return s.walkState(PublicStateDataFileName, PublicStateMetadataFileName, fn)
+}
+
+// PrivateStateHashes calls fn for every hashed private state of the snapshot.
+// Their namespaces are <namespace>$$h<collection> and keys are the key hashes.
+func (s *Snapshot) PrivateStateHashes(fn func(state.KVSet) error) error {
+	return s.walkState(PrivateStateHashesDataFileName, PrivateStateHashesMetadataFileName, fn)
+}
+
+type namespaceCount struct {
+	namespace string
+	count     uint64
+}
+
+// walkState reads a state data file. The metadata file lists the namespaces in the
+// order of the data file with their number of entries; the data file starts with the
+// value format of the exporting statedb, followed by the key and value of every entry.
+func (s *Snapshot) walkState(dataFileName, metadataFileName string, fn func(state.KVSet) error) error {
+	counts, err := s.readNamespaceCounts(metadataFileName)
+	if err != nil {
+		return err
+	}
+	data, err := openFile(filepath.Join(s.Dir, dataFileName), snapshotFileFormat)
+	if err != nil {
+		return err
+	}
+	defer data.close()
+
+	valueFormat, err := data.decodeBytes()
+	if err != nil {
+		return fmt.Errorf("error: cannot read the value format of [%s], error=[%v]", dataFileName, err)
+	}
+	if !bytes.Equal(valueFormat, []byte{levelDBValueFormat}) {
+		return fmt.Errorf("error: unsupported value format [%x] in [%s], state db type [%s]", valueFormat, dataFileName, s.Metadata.StateDBType)
+	}
+
+	for _, nc := range counts {
+		for i := uint64(0); i < nc.count; i++ {
+			key, err := data.decodeBytes()
+			if err != nil {
+				return fmt.Errorf("error: cannot read key [%d] of namespace [%s], error=[%v]", i, nc.namespace, err)
+			}
+			value, err := data.decodeBytes()
+			if err != nil {
+				return fmt.Errorf("error: cannot read value [%d] of namespace [%s], error=[%v]", i, nc.namespace, err)
+			}
+			kv, err := state.ParseKV(stateKey(s.Metadata.ChannelName, nc.namespace, key), value, "")
+			if err != nil {
+				return err
+			}
+			if err := fn(kv); err != nil {
+				return err
+			}
+		}
+	}
+	if !data.atEOF() {
+		return fmt.Errorf("error: [%s] holds more entries than recorded in [%s]", dataFileName, metadataFileName)
+	}
+	return nil
+}
+
+// stateKey builds the stateLeveldb key of a snapshot entry
+func stateKey(channel, namespace string, key []byte) []byte {
+	k := append([]byte(channel), 0x00, 'd')
+	k = append(append(k, namespace...), 0x00)
+	return append(k, key...)
+}
+
+func (s *Snapshot) readCount(metadataFileName string) (uint64, error) {
+	metadata, err := openFile(filepath.Join(s.Dir, metadataFileName), snapshotFileFormat)
+	if err != nil {
+		return 0, err
+	}
+	defer metadata.close()
+	return metadata.decodeUVarint()
+}
+
+func (s *Snapshot) readNamespaceCounts(metadataFileName string) ([]namespaceCount, error) {
+	metadata, err := openFile(filepath.Join(s.Dir, metadataFileName), snapshotFileFormat)
+	if err != nil {
+		return nil, err
+	}
+	defer metadata.close()
+
+	numNamespaces, err := metadata.decodeUVarint()
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]namespaceCount, numNamespaces)
+	for i := range counts {
+		if counts[i].namespace, err = metadata.decodeString(); err != nil {
+			return nil, err
+		}
+		if counts[i].count, err = metadata.decodeUVarint(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
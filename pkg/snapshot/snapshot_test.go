@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+type fileWriter []byte
+
+func (w *fileWriter) uvarint(n uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	*w = append(*w, buf[:binary.PutUvarint(buf, n)]...)
+}
+
+func (w *fileWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	*w = append(*w, b...)
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte, hashes map[string]string) {
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), content, 0644))
+	sum := sha256.Sum256(content)
+	hashes[name] = hex.EncodeToString(sum[:])
+}
+
+func newTestSnapshot(t *testing.T, dir string) {
+	hashes := map[string]string{}
+
+	txids := fileWriter{snapshotFileFormat}
+	txids.bytes([]byte("tx1"))
+	txids.bytes([]byte("tx2"))
+	writeFile(t, dir, TxIDsDataFileName, txids, hashes)
+	txidsMeta := fileWriter{snapshotFileFormat}
+	txidsMeta.uvarint(2)
+	writeFile(t, dir, TxIDsMetadataFileName, txidsMeta, hashes)
+
+	value, err := utils.EncodeValue(&statedb.VersionedValue{Value: []byte("100"), Version: version.NewHeight(5, 0)})
+	assert.NoError(t, err)
+	pub := fileWriter{snapshotFileFormat}
+	pub.bytes([]byte{levelDBValueFormat})
+	pub.bytes([]byte("a"))
+	pub.bytes(value)
+	pub.bytes([]byte("b"))
+	pub.bytes(value)
+	writeFile(t, dir, PublicStateDataFileName, pub, hashes)
+	pubMeta := fileWriter{snapshotFileFormat}
+	pubMeta.uvarint(1)
+	pubMeta.bytes([]byte("mycc"))
+	pubMeta.uvarint(2)
+	writeFile(t, dir, PublicStateMetadataFileName, pubMeta, hashes)
+
+	keyHash := sha256.Sum256([]byte("secret"))
+	pvt := fileWriter{snapshotFileFormat}
+	pvt.bytes([]byte{levelDBValueFormat})
+	pvt.bytes(keyHash[:])
+	pvt.bytes(value)
+	writeFile(t, dir, PrivateStateHashesDataFileName, pvt, hashes)
+	pvtMeta := fileWriter{snapshotFileFormat}
+	pvtMeta.uvarint(1)
+	pvtMeta.bytes([]byte("mycc$$hcoll"))
+	pvtMeta.uvarint(1)
+	writeFile(t, dir, PrivateStateHashesMetadataFileName, pvtMeta, hashes)
+
+	signable, err := json.Marshal(&SignableMetadata{
+		ChannelName:     "mychannel",
+		LastBlockNumber: 5,
+		FilesAndHashes:  hashes,
+		StateDBType:     "goleveldb",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, SignableMetadataFileName), signable, 0644))
+	sum := sha256.Sum256(signable)
+	additional, err := json.Marshal(&AdditionalMetadata{SnapshotHashInHex: hex.EncodeToString(sum[:])})
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, AdditionalMetadataFileName), additional, 0644))
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	newTestSnapshot(t, dir)
+
+	s, err := Open(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "mychannel", s.Metadata.ChannelName)
+	assert.Equal(t, uint64(5), s.Metadata.LastBlockNumber)
+
+	checks := s.Verify()
+	assert.Len(t, checks, 7)
+	for _, c := range checks {
+		assert.True(t, c.OK(), c.String())
+	}
+
+	var txIDs []string
+	assert.NoError(t, s.TxIDs(func(txID string) error {
+		txIDs = append(txIDs, txID)
+		return nil
+	}))
+	assert.Equal(t, []string{"tx1", "tx2"}, txIDs)
+
+	var public []state.KVSet
+	assert.NoError(t, s.PublicState(func(kv state.KVSet) error {
+		public = append(public, kv)
+		return nil
+	}))
+	assert.Len(t, public, 2)
+	assert.Equal(t, state.UserPublic, public[0].Type())
+	assert.Equal(t, []byte("mychannel\x00dmycc\x00a"), public[0].Key())
+	assert.Equal(t, "100", public[1].Value())
+
+	var hashed []state.KVSet
+	assert.NoError(t, s.PrivateStateHashes(func(kv state.KVSet) error {
+		hashed = append(hashed, kv)
+		return nil
+	}))
+	assert.Len(t, hashed, 1)
+	assert.Equal(t, state.UserPrivate, hashed[0].Type())
+
+	// tampering with a file is reported
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, TxIDsDataFileName), []byte{snapshotFileFormat}, 0644))
+	for _, c := range s.Verify() {
+		assert.Equal(t, c.File != TxIDsDataFileName, c.OK(), c.String())
+	}
+	assert.Error(t, s.TxIDs(func(string) error { return nil }))
+}
@@ -0,0 +1,209 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/common/tools/protolator"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/the-medium/ledger-parser/pkg/block"
+	"github.com/the-medium/ledger-parser/pkg/index"
+)
+
+// ChannelConfigKey is the key of the peer namespace "" holding the config envelope of the last config block
+const ChannelConfigKey = "CHANNEL_CONFIG_ENV_BYTES"
+
+// ConfigEnvelope returns the config envelope stored in the entry
+func (kv ChannelConfigKV) ConfigEnvelope() (*common.ConfigEnvelope, error) {
+	r, err := kv.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalConfigEnvelope(r.Value)
+}
+
+// Config returns the channel config stored in the entry
+func (kv ChannelConfigKV) Config() (*common.Config, error) {
+	env, err := kv.ConfigEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	if env.Config == nil {
+		return nil, fmt.Errorf("the config envelope holds no config")
+	}
+	return env.Config, nil
+}
+
+// JSON renders the config envelope the way configtxlator does, with every nested value decoded
+func (kv ChannelConfigKV) JSON() ([]byte, error) {
+	env, err := kv.ConfigEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	return configJSON(env)
+}
+
+func unmarshalConfigEnvelope(value []byte) (*common.ConfigEnvelope, error) {
+	env := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(value, env); err != nil {
+		return nil, fmt.Errorf("cannot decode the config envelope, error=[%v]", err)
+	}
+	return env, nil
+}
+
+func configJSON(env *common.ConfigEnvelope) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := protolator.DeepMarshalJSON(&buf, env); err != nil {
+		return nil, fmt.Errorf("cannot render the config envelope, error=[%v]", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ChannelConfig returns the config envelope of a channel stored in the state db and its version,
+// nil if the channel has none
+func (r *StateReader) ChannelConfig(channel string) (*common.ConfigEnvelope, *version.Height, error) {
+	vv, err := r.Get(channel, "", ChannelConfigKey)
+	if err != nil || vv == nil {
+		return nil, nil, err
+	}
+	env, err := unmarshalConfigEnvelope(vv.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return env, vv.Version, nil
+}
+
+// ConfigComparison is the result of comparing the channel config in the state db with the
+// latest config block in the blockfiles
+type ConfigComparison struct {
+	Channel       string   `json:"channel"`
+	StateVersion  string   `json:"state_version"` // the block number is the one of the config block committed last
+	StateSequence uint64   `json:"state_sequence"`
+	BlockNum      uint64   `json:"block_num"`
+	BlockSequence uint64   `json:"block_sequence"`
+	Differences   []string `json:"differences,omitempty"`
+}
+
+// OK reports whether the state holds the config of the latest config block
+func (c *ConfigComparison) OK() bool {
+	return len(c.Differences) == 0
+}
+
+// JSON returns the comparison encoded as indented JSON
+func (c *ConfigComparison) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// CompareChannelConfig compares the channel config stored in the state db with the latest
+// config block in the blockfiles of the ledger
+func CompareChannelConfig(r *StateReader, store *index.BlockStore, channel string) (*ConfigComparison, error) {
+	env, height, err := r.ChannelConfig(channel)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return nil, fmt.Errorf("error: no channel config found in the state of channel [%s]", channel)
+	}
+	configBlock, err := store.LatestConfigBlock(channel)
+	if err != nil {
+		return nil, err
+	}
+	return CompareConfigBlock(channel, env, height, configBlock)
+}
+
+// CompareConfigBlock compares a config envelope stored in the state db at height with a config block
+func CompareConfigBlock(channel string, env *common.ConfigEnvelope, height *version.Height, configBlock *common.Block) (*ConfigComparison, error) {
+	blockEnv, err := block.GetConfigEnvelope(configBlock)
+	if err != nil {
+		return nil, err
+	}
+	c := &ConfigComparison{
+		Channel:       channel,
+		StateVersion:  height.String(),
+		StateSequence: env.GetConfig().GetSequence(),
+		BlockNum:      configBlock.Header.Number,
+		BlockSequence: blockEnv.GetConfig().GetSequence(),
+	}
+	if height.BlockNum != c.BlockNum {
+		c.Differences = append(c.Differences, fmt.Sprintf("the state was written by block [%d], not by config block [%d]", height.BlockNum, c.BlockNum))
+	}
+	if c.StateSequence != c.BlockSequence {
+		c.Differences = append(c.Differences, fmt.Sprintf("sequence [%d] differs from the sequence [%d] of the config block", c.StateSequence, c.BlockSequence))
+	}
+	c.Differences = append(c.Differences, diffConfigGroup("/Channel", env.GetConfig().GetChannelGroup(), blockEnv.GetConfig().GetChannelGroup())...)
+	return c, nil
+}
+
+// diffConfigGroup lists the values, policies and groups that differ between two config groups, a in the state and b in the block
+func diffConfigGroup(path string, a, b *common.ConfigGroup) []string {
+	var diffs []string
+	if a.GetModPolicy() != b.GetModPolicy() || a.GetVersion() != b.GetVersion() {
+		diffs = append(diffs, fmt.Sprintf("%s: version %d and mod policy [%s] in state, version %d and mod policy [%s] in block",
+			path, a.GetVersion(), a.GetModPolicy(), b.GetVersion(), b.GetModPolicy()))
+	}
+	for _, name := range unionKeys(a.GetValues(), b.GetValues()) {
+		va, inA := a.GetValues()[name]
+		vb, inB := b.GetValues()[name]
+		diffs = appendItemDiff(diffs, path+"/values/"+name, inA, inB, proto.Equal(va, vb))
+	}
+	for _, name := range unionKeys(a.GetPolicies(), b.GetPolicies()) {
+		pa, inA := a.GetPolicies()[name]
+		pb, inB := b.GetPolicies()[name]
+		diffs = appendItemDiff(diffs, path+"/policies/"+name, inA, inB, proto.Equal(pa, pb))
+	}
+	for _, name := range unionKeys(a.GetGroups(), b.GetGroups()) {
+		ga, gb := a.GetGroups()[name], b.GetGroups()[name]
+		switch {
+		case ga == nil:
+			diffs = append(diffs, fmt.Sprintf("%s/%s: only in block", path, name))
+		case gb == nil:
+			diffs = append(diffs, fmt.Sprintf("%s/%s: only in state", path, name))
+		default:
+			diffs = append(diffs, diffConfigGroup(path+"/"+name, ga, gb)...)
+		}
+	}
+	return diffs
+}
+
+func appendItemDiff(diffs []string, path string, inA, inB, equal bool) []string {
+	switch {
+	case !inA:
+		return append(diffs, path+": only in block")
+	case !inB:
+		return append(diffs, path+": only in state")
+	case !equal:
+		return append(diffs, path+": differs")
+	}
+	return diffs
+}
+
+// unionKeys returns the sorted names of two maps of values, policies or groups
+func unionKeys(a, b interface{}) []string {
+	set := map[string]bool{}
+	for _, m := range []interface{}{a, b} {
+		switch m := m.(type) {
+		case map[string]*common.ConfigValue:
+			for k := range m {
+				set[k] = true
+			}
+		case map[string]*common.ConfigPolicy:
+			for k := range m {
+				set[k] = true
+			}
+		case map[string]*common.ConfigGroup:
+			for k := range m {
+				set[k] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
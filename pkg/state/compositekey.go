@@ -0,0 +1,74 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	compositeKeyNamespace = "\x00"
+	minUnicodeRuneValue   = 0            // U+0000
+	maxUnicodeRuneValue   = utf8.MaxRune // U+10FFFF - maximum (and unallocated) code point
+)
+
+// CompositeKey is a key created with the chaincode shim's CreateCompositeKey:
+// \x00<objectType>\x00<attr1>\x00<attr2>\x00...
+type CompositeKey struct {
+	ObjectType string   `json:"object_type"`
+	Attributes []string `json:"attributes"`
+}
+
+func (c *CompositeKey) String() string {
+	return fmt.Sprintf("%s[%s]", c.ObjectType, strings.Join(c.Attributes, ", "))
+}
+
+// SplitCompositeKey decodes a composite key, it returns false for a simple key
+func SplitCompositeKey(key string) (*CompositeKey, bool) {
+	if !strings.HasPrefix(key, compositeKeyNamespace) || !strings.HasSuffix(key, string(rune(minUnicodeRuneValue))) || len(key) < 2 {
+		return nil, false
+	}
+	components := strings.Split(key[1:len(key)-1], string(rune(minUnicodeRuneValue)))
+	for _, c := range components {
+		if !utf8.ValidString(c) || strings.ContainsRune(c, maxUnicodeRuneValue) {
+			return nil, false
+		}
+	}
+	return &CompositeKey{ObjectType: components[0], Attributes: components[1:]}, true
+}
+
+// CreateCompositeKey encodes a composite key the way the chaincode shim does
+func CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	if err := validateCompositeKeyAttribute(objectType); err != nil {
+		return "", err
+	}
+	ck := compositeKeyNamespace + objectType + string(rune(minUnicodeRuneValue))
+	for _, att := range attributes {
+		if err := validateCompositeKeyAttribute(att); err != nil {
+			return "", err
+		}
+		ck += att + string(rune(minUnicodeRuneValue))
+	}
+	return ck, nil
+}
+
+func validateCompositeKeyAttribute(str string) error {
+	if !utf8.ValidString(str) {
+		return fmt.Errorf("not a valid utf8 string: [%x]", str)
+	}
+	for index, runeValue := range str {
+		if runeValue == minUnicodeRuneValue || runeValue == maxUnicodeRuneValue {
+			return fmt.Errorf(`input contains unicode %#U starting at position [%d]. %#U and %#U are not allowed in the input attribute of a composite key`,
+				runeValue, index, minUnicodeRuneValue, maxUnicodeRuneValue)
+		}
+	}
+	return nil
+}
+
+// displayKey renders composite keys readable and leaves simple keys as they are
+func displayKey(key string) string {
+	if ck, ok := SplitCompositeKey(key); ok {
+		return ck.String()
+	}
+	return key
+}
@@ -0,0 +1,243 @@
+package state
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	goproto "github.com/golang/protobuf/proto"
+)
+
+// ContentType is the encoding of a user chaincode value
+type ContentType int
+
+const (
+	// Auto detects the content type of each value, it is only used for overrides
+	Auto ContentType = iota
+	Binary
+	Text
+	JSON
+	Protobuf
+	Gzip
+)
+
+var contentTypeNames = map[ContentType]string{
+	Auto:     "auto",
+	Binary:   "binary",
+	Text:     "text",
+	JSON:     "json",
+	Protobuf: "protobuf",
+	Gzip:     "gzip",
+}
+
+func (t ContentType) String() string {
+	if name, ok := contentTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ContentType(%d)", int(t))
+}
+
+// ParseContentType returns the content type of a name such as "json" or "protobuf"
+func ParseContentType(name string) (ContentType, error) {
+	for t, n := range contentTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return Auto, fmt.Errorf("unknown content type [%s]", name)
+}
+
+// maxProtoDepth limits the nesting of messages decoded without their schema
+const maxProtoDepth = 8
+
+// DetectContentType sniffs the encoding of a value: gzip by its magic number, JSON, then
+// printable UTF-8 text, then the protobuf wire format. Anything else is binary.
+func DetectContentType(value []byte) ContentType {
+	switch {
+	case len(value) == 0:
+		return Text
+	case len(value) > 2 && value[0] == 0x1f && value[1] == 0x8b:
+		return Gzip
+	case json.Valid(value):
+		return JSON
+	case isPrintable(value):
+		return Text
+	}
+	if _, ok := decodeProtoFields(value, 0); ok {
+		return Protobuf
+	}
+	return Binary
+}
+
+// ValueRenderer renders user chaincode values, detecting their content type unless
+// it is overridden for the namespace
+type ValueRenderer struct {
+	mutex     sync.RWMutex
+	overrides map[string]ContentType
+}
+
+// NewValueRenderer returns a ValueRenderer without overrides. A nil *ValueRenderer detects
+// the content type of every value.
+func NewValueRenderer() *ValueRenderer {
+	return &ValueRenderer{overrides: map[string]ContentType{}}
+}
+
+// SetContentType overrides the detection for the values of a namespace, Auto restores it
+func (r *ValueRenderer) SetContentType(ns string, t ContentType) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if t == Auto {
+		delete(r.overrides, ns)
+		return
+	}
+	r.overrides[ns] = t
+}
+
+// ContentType returns the content type of a value of a namespace
+func (r *ValueRenderer) ContentType(ns string, value []byte) ContentType {
+	if r == nil {
+		return DetectContentType(value)
+	}
+	r.mutex.RLock()
+	t, ok := r.overrides[ns]
+	r.mutex.RUnlock()
+	if ok {
+		return t
+	}
+	return DetectContentType(value)
+}
+
+// Render returns the content type of a value and its readable form: JSON and text as they are,
+// protobuf messages as JSON keyed by field number, gzip by its decompressed content and
+// binary values hex encoded. A value that does not decode as the overridden type is rendered
+// as binary.
+func (r *ValueRenderer) Render(ns string, value []byte) (ContentType, string) {
+	t := r.ContentType(ns, value)
+	return t, render(t, value)
+}
+
+func render(t ContentType, value []byte) string {
+	switch t {
+	case JSON:
+		if json.Valid(value) {
+			return string(value)
+		}
+	case Text:
+		if utf8.Valid(value) {
+			return string(value)
+		}
+	case Protobuf:
+		if fields, ok := decodeProtoFields(value, 0); ok {
+			if b, err := json.Marshal(fields); err == nil {
+				return string(b)
+			}
+		}
+	case Gzip:
+		if inflated, err := gunzip(value); err == nil {
+			return render(DetectContentType(inflated), inflated)
+		}
+	}
+	return hex.EncodeToString(value)
+}
+
+func gunzip(value []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// isPrintable reports whether value is UTF-8 text without control characters other than white space
+func isPrintable(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeProtoFields decodes a protobuf message without its schema into a map keyed by
+// field number. Repeated fields become arrays, length delimited fields become nested
+// messages, strings or base64. It fails unless b is a well formed message.
+func decodeProtoFields(b []byte, depth int) (map[string]interface{}, bool) {
+	if len(b) == 0 || depth > maxProtoDepth {
+		return nil, false
+	}
+	fields := map[string]interface{}{}
+	for len(b) > 0 {
+		tag, n := goproto.DecodeVarint(b)
+		if n == 0 {
+			return nil, false
+		}
+		b = b[n:]
+		fieldNum, wireType := tag>>3, tag&7
+		if fieldNum == 0 || fieldNum > 1<<29-1 {
+			return nil, false
+		}
+
+		var value interface{}
+		switch wireType {
+		case goproto.WireVarint:
+			v, n := goproto.DecodeVarint(b)
+			if n == 0 {
+				return nil, false
+			}
+			value, b = v, b[n:]
+		case goproto.WireFixed64:
+			if len(b) < 8 {
+				return nil, false
+			}
+			v, _ := goproto.NewBuffer(b[:8]).DecodeFixed64()
+			value, b = v, b[8:]
+		case goproto.WireFixed32:
+			if len(b) < 4 {
+				return nil, false
+			}
+			v, _ := goproto.NewBuffer(b[:4]).DecodeFixed32()
+			value, b = v, b[4:]
+		case goproto.WireBytes:
+			l, n := goproto.DecodeVarint(b)
+			if n == 0 || l > uint64(len(b)-n) {
+				return nil, false
+			}
+			value, b = decodeProtoBytes(b[n:n+int(l)], depth), b[n+int(l):]
+		default: // groups are deprecated and not supported
+			return nil, false
+		}
+
+		key := strconv.FormatUint(fieldNum, 10)
+		switch existing := fields[key].(type) {
+		case nil:
+			fields[key] = value
+		case []interface{}:
+			fields[key] = append(existing, value)
+		default:
+			fields[key] = []interface{}{existing, value}
+		}
+	}
+	return fields, true
+}
+
+func decodeProtoBytes(b []byte, depth int) interface{} {
+	if isPrintable(b) {
+		return string(b)
+	}
+	if nested, ok := decodeProtoFields(b, depth+1); ok {
+		return nested
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
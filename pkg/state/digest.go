@@ -0,0 +1,140 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+// Digest is the sha256 over the sorted entries of a namespace or of a collection's hashed state
+type Digest struct {
+	Keys   int    `json:"keys"`
+	Digest string `json:"digest"` // hex encoded
+
+	hash hash.Hash
+}
+
+// NamespaceDigest is the digest of the public state of a namespace and of its collections
+type NamespaceDigest struct {
+	Digest
+	Collections map[string]*Digest `json:"collections,omitempty"` // hashed state, comparable between members and non-members
+}
+
+// DigestReport holds the state digests of a channel. Cleartext private data is left out
+// since only member peers hold it, the hashed state covers it.
+type DigestReport struct {
+	Channel    string                      `json:"channel"`
+	SavePoint  string                      `json:"savepoint,omitempty"`
+	Namespaces map[string]*NamespaceDigest `json:"namespaces"`
+}
+
+// NewDigestReport digests every namespace and collection of a channel. Each entry is hashed
+// in key order as its key, value, block number, transaction number and metadata entries sorted
+// by name, every field length prefixed, so the digest does not depend on the data format.
+func NewDigestReport(db *leveldb.DB, channel string) (*DigestReport, error) {
+	f, err := format.Detect(db)
+	if err != nil {
+		return nil, err
+	}
+	report := &DigestReport{Channel: channel, Namespaces: map[string]*NamespaceDigest{}}
+	iter := db.NewIterator(lutil.BytesPrefix(append([]byte(channel), 0x00)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return nil, err
+		}
+		if kv == nil || kv.Type() == FormatVersion {
+			continue
+		}
+		record, err := kv.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if kv.Type() == SavePoint {
+			report.SavePoint = record.Version.String()
+			continue
+		}
+		if record.Collection != "" && !record.Hashed {
+			continue
+		}
+		report.digest(record).add(record)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	for _, nd := range report.Namespaces {
+		nd.sum()
+		for _, d := range nd.Collections {
+			d.sum()
+		}
+	}
+	return report, nil
+}
+
+// digest returns the digest the record belongs to
+func (r *DigestReport) digest(record *Record) *Digest {
+	nd, ok := r.Namespaces[record.Namespace]
+	if !ok {
+		nd = &NamespaceDigest{Digest: Digest{hash: sha256.New()}, Collections: map[string]*Digest{}}
+		r.Namespaces[record.Namespace] = nd
+	}
+	if record.Collection == "" {
+		return &nd.Digest
+	}
+	d, ok := nd.Collections[record.Collection]
+	if !ok {
+		d = &Digest{hash: sha256.New()}
+		nd.Collections[record.Collection] = d
+	}
+	return d
+}
+
+func (d *Digest) add(record *Record) {
+	writeField(d.hash, []byte(record.Key))
+	writeField(d.hash, record.Value)
+	var height [16]byte
+	binary.BigEndian.PutUint64(height[:8], record.Version.BlockNum)
+	binary.BigEndian.PutUint64(height[8:], record.Version.TxNum)
+	d.hash.Write(height[:])
+
+	names := make([]string, 0, len(record.Metadata))
+	for name := range record.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeLength(d.hash, len(names))
+	for _, name := range names {
+		writeField(d.hash, []byte(name))
+		writeField(d.hash, record.Metadata[name])
+	}
+	d.Keys++
+}
+
+func (d *Digest) sum() {
+	d.Digest = hex.EncodeToString(d.hash.Sum(nil))
+	d.hash = nil
+}
+
+func writeLength(h hash.Hash, n int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(n))
+	h.Write(b[:])
+}
+
+func writeField(h hash.Hash, field []byte) {
+	writeLength(h, len(field))
+	h.Write(field)
+}
+
+// JSON returns the report encoded as compact JSON
+func (r *DigestReport) JSON() ([]byte, error) {
+	return json.Marshal(r)
+}
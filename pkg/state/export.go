@@ -0,0 +1,151 @@
+package state
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+// ExportedRecord is the JSON form of a data Record
+type ExportedRecord struct {
+	Channel      string            `json:"channel"`
+	Namespace    string            `json:"namespace"`
+	Collection   string            `json:"collection,omitempty"`
+	Hashed       bool              `json:"hashed,omitempty"`
+	Key          string            `json:"key,omitempty"`
+	KeyHex       string            `json:"key_hex,omitempty"` // set instead of Key for hashes and keys that are not UTF-8
+	CompositeKey *CompositeKey     `json:"composite_key,omitempty"`
+	Value        *string           `json:"value,omitempty"`
+	ValueBase64  []byte            `json:"value_base64,omitempty"` // set instead of Value for hashes and binary values
+	Version      *ExportedVersion  `json:"version,omitempty"`
+	Metadata     map[string][]byte `json:"metadata,omitempty"`
+}
+
+// ExportedVersion is the JSON form of a version.Height
+type ExportedVersion struct {
+	BlockNum uint64 `json:"block_num"`
+	TxNum    uint64 `json:"tx_num"`
+}
+
+// NewExportedRecord converts a Record into its JSON form
+func NewExportedRecord(r *Record) *ExportedRecord {
+	e := &ExportedRecord{
+		Channel:      r.Channel,
+		Namespace:    r.Namespace,
+		Collection:   r.Collection,
+		Hashed:       r.Hashed,
+		CompositeKey: r.Composite,
+		Metadata:     r.Metadata,
+	}
+	if r.Hashed || !utf8.ValidString(r.Key) {
+		e.KeyHex = hex.EncodeToString([]byte(r.Key))
+	} else {
+		e.Key = r.Key
+	}
+	if r.Hashed || !utf8.Valid(r.Value) {
+		e.ValueBase64 = r.Value
+	} else {
+		value := string(r.Value)
+		e.Value = &value
+	}
+	if r.Version != nil {
+		e.Version = &ExportedVersion{r.Version.BlockNum, r.Version.TxNum}
+	}
+	return e
+}
+
+// Exporter writes records as a JSON array with one record per line
+type Exporter struct {
+	w     io.Writer
+	count int
+}
+
+// NewExporter returns an Exporter writing to w
+func NewExporter(w io.Writer) *Exporter {
+	return &Exporter{w: w}
+}
+
+// Write appends a record to the array
+func (e *Exporter) Write(r *Record) error {
+	b, err := json.Marshal(NewExportedRecord(r))
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "[\n"
+	}
+	if _, err := fmt.Fprintf(e.w, "%s%s", sep, b); err != nil {
+		return err
+	}
+	e.count++
+	return nil
+}
+
+// Close terminates the array, an empty one when no record was written
+func (e *Exporter) Close() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// Export writes the records as a JSON array
+func Export(w io.Writer, records []*Record) error {
+	e := NewExporter(w)
+	for _, r := range records {
+		if err := e.Write(r); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+// ExportNamespace writes the current state of a namespace, including its private
+// data collections, as a JSON array
+func ExportNamespace(w io.Writer, db *leveldb.DB, channel, ns string) error {
+	f, err := format.Detect(db)
+	if err != nil {
+		return err
+	}
+	prefix := append([]byte(channel), 0x00)
+	if f != format.V1_4 {
+		prefix = append(prefix, 'd')
+	}
+	// the prefix also covers namespaces starting with ns, they are filtered below
+	iter := db.NewIterator(lutil.BytesPrefix(append(prefix, ns...)), nil)
+	defer iter.Release()
+
+	e := NewExporter(w)
+	for iter.Next() {
+		kv, err := ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return err
+		}
+		if kv == nil || kv.Type() == FormatVersion || kv.Type() == SavePoint {
+			continue
+		}
+		record, err := kv.Decode()
+		if err != nil {
+			return err
+		}
+		if record.Namespace != ns {
+			continue
+		}
+		if err := e.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return e.Close()
+}
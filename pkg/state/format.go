@@ -0,0 +1,34 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/the-medium/ledger-parser/internal/utils"
+)
+
+// fromV14 translates a stateLeveldb entry written by a 1.x peer into the 2.0 encoding.
+//
+//	1.x: <channel>\x00<ns>\x00<key>  -> [\x00]VersionedValueProto or version||value, savepoint <channel>\x00\x00
+//	2.0: <channel>\x00d<ns>\x00<key> -> VersionedValueProto, savepoint <channel>\x00s
+func fromV14(key []byte, value []byte) ([]byte, []byte, error) {
+	nsKey := bytes.SplitN(key, []byte{0x00}, 2)
+	if len(nsKey) != 2 || len(nsKey[1]) == 0 {
+		return nil, nil, fmt.Errorf("invalid 1.x state key [%x]", key)
+	}
+	channel := append(append([]byte{}, nsKey[0]...), 0x00)
+
+	if bytes.Equal(nsKey[1], []byte{0x00}) {
+		return append(channel, 's'), value, nil
+	}
+
+	versionedValue, err := utils.DecodeValueV14(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedValue, err := utils.EncodeValue(versionedValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(append(channel, 'd'), nsKey[1]...), encodedValue, nil
+}
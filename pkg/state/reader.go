@@ -0,0 +1,170 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+// VersionedKV is a key of a namespace with its versioned value
+type VersionedKV struct {
+	Key string
+	*statedb.VersionedValue
+}
+
+// StateReader looks up keys of a stateLeveldb without iterating over the whole db
+type StateReader struct {
+	db     *leveldb.DB
+	format format.Version
+}
+
+// OpenStateReader opens the stateLeveldb at path read-only
+func OpenStateReader(path string) (*StateReader, error) {
+	opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+	db, err := leveldb.OpenFile(path, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot open state db: [%s], error=[%v]", path, err)
+	}
+	r, err := NewStateReader(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewStateReader returns a StateReader on an already opened stateLeveldb.
+// An empty db holds nothing to misread and is read as 2.0.
+func NewStateReader(db *leveldb.DB) (*StateReader, error) {
+	f, err := format.Detect(db)
+	if err == format.ErrEmptyDB {
+		f, err = format.V2_0, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot detect the format of the state db, error=[%v]", err)
+	}
+	return &StateReader{db: db, format: f}, nil
+}
+
+// Close closes the db
+func (r *StateReader) Close() error {
+	return r.db.Close()
+}
+
+// Format returns the data format of the db
+func (r *StateReader) Format() format.Version {
+	return r.format
+}
+
+// dataKey encodes the key of a namespace: <channel>\x00d<ns>\x00<key>, or <channel>\x00<ns>\x00<key> in 1.x
+func (r *StateReader) dataKey(channel, ns, key string) []byte {
+	k := append([]byte(channel), 0x00)
+	if r.format != format.V1_4 {
+		k = append(k, 'd')
+	}
+	k = append(append(k, ns...), 0x00)
+	return append(k, key...)
+}
+
+func (r *StateReader) decodeValue(value []byte) (*statedb.VersionedValue, error) {
+	if r.format == format.V1_4 {
+		return utils.DecodeValueV14(value)
+	}
+	return utils.DecodeValue(value)
+}
+
+func (r *StateReader) get(channel, ns, key string) (*statedb.VersionedValue, error) {
+	value, err := r.db.Get(r.dataKey(channel, ns, key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeValue(value)
+}
+
+// Get returns the public state of a key, nil if the key does not exist
+func (r *StateReader) Get(channel, ns, key string) (*statedb.VersionedValue, error) {
+	return r.get(channel, ns, key)
+}
+
+// GetPrivate returns the private state of a key of a collection, nil if the peer does not hold it
+func (r *StateReader) GetPrivate(channel, ns, coll, key string) (*statedb.VersionedValue, error) {
+	return r.get(channel, ns+nsJoiner+pvtDataPrefix+coll, key)
+}
+
+// GetPrivateHash returns the hashed private state stored under the hash of a key
+func (r *StateReader) GetPrivateHash(channel, ns, coll string, keyHash []byte) (*statedb.VersionedValue, error) {
+	return r.get(channel, ns+nsJoiner+hashDataPrefix+coll, string(keyHash))
+}
+
+// GetRange returns an iterator over the public keys of a namespace in [start, end).
+// An empty end iterates up to the last key of the namespace.
+func (r *StateReader) GetRange(channel, ns, start, end string) *RangeIterator {
+	return r.rangeOf(channel, ns, start, end)
+}
+
+// GetByPartialCompositeKey returns an iterator over the public composite keys of a namespace
+// starting with the object type and attributes, like GetStateByPartialCompositeKey of the shim
+func (r *StateReader) GetByPartialCompositeKey(channel, ns, objectType string, attributes []string) (*RangeIterator, error) {
+	start, err := CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return r.rangeOf(channel, ns, start, start+string(maxUnicodeRuneValue)), nil
+}
+
+// GetPrivateByPartialCompositeKey is GetByPartialCompositeKey for the private state of a collection
+func (r *StateReader) GetPrivateByPartialCompositeKey(channel, ns, coll, objectType string, attributes []string) (*RangeIterator, error) {
+	start, err := CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return r.rangeOf(channel, ns+nsJoiner+pvtDataPrefix+coll, start, start+string(maxUnicodeRuneValue)), nil
+}
+
+func (r *StateReader) rangeOf(channel, ns, start, end string) *RangeIterator {
+	rng := &lutil.Range{Start: r.dataKey(channel, ns, start)}
+	if end == "" {
+		// 0x01 sorts after the nil byte separating the namespace from every key
+		limit := r.dataKey(channel, ns, "")
+		limit[len(limit)-1] = 0x01
+		rng.Limit = limit
+	} else {
+		rng.Limit = r.dataKey(channel, ns, end)
+	}
+	prefixLen := len(r.dataKey(channel, ns, ""))
+	return &RangeIterator{reader: r, iter: r.db.NewIterator(rng, nil), prefixLen: prefixLen}
+}
+
+// RangeIterator iterates over the result of GetRange
+type RangeIterator struct {
+	reader    *StateReader
+	iter      iterator.Iterator
+	prefixLen int
+}
+
+// Next returns the next key, nil after the last one
+func (it *RangeIterator) Next() (*VersionedKV, error) {
+	if !it.iter.Next() {
+		return nil, it.iter.Error()
+	}
+	// copy, the iterator reuses its buffer and a 1.x value may point into it
+	value, err := it.reader.decodeValue(append([]byte{}, it.iter.Value()...))
+	if err != nil {
+		return nil, err
+	}
+	return &VersionedKV{Key: string(it.iter.Key()[it.prefixLen:]), VersionedValue: value}, nil
+}
+
+// Close releases the iterator
+func (it *RangeIterator) Close() {
+	it.iter.Release()
+}
@@ -0,0 +1,175 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	goproto "github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	lb "github.com/hyperledger/fabric-protos-go/peer/lifecycle"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/the-medium/ledger-parser/internal/utils"
+)
+
+// Record is the decoded form of a stateLeveldb entry
+type Record struct {
+	Channel    string
+	Namespace  string
+	Collection string // private data collection, empty for public data
+	Hashed     bool   // Key and Value are the hashes of the private key and value
+	Key        string
+	Composite  *CompositeKey // set when Key is a composite key
+	Value      []byte
+	Version    *version.Height   // nil for the format version
+	Metadata   map[string][]byte // key level metadata, e.g. VALIDATION_PARAMETER
+	Lifecycle  *LifecycleField   // decoded _lifecycle entry, nil for other namespaces and hashes
+}
+
+// LifecycleField is a decoded _lifecycle entry:
+// <Space>/metadata/<Name> or <Space>/fields/<Name>/<Field>
+type LifecycleField struct {
+	Space string // "namespaces" or "chaincode-sources"
+	Infix string // "metadata" or "fields"
+	Name  string // chaincode name, <name>#<sequence> in the org private collections
+	Field string // empty for metadata
+
+	// Value is one of *lb.StateMetadata (metadata), int64 (Sequence), *lb.ChaincodeEndorsementInfo,
+	// *lb.ChaincodeValidationInfo, *pb.CollectionConfigPackage, string (PackageID) or *lb.StateData
+	// for fields unknown to this parser
+	Value interface{}
+}
+
+// dataKey is a stateLeveldb data key: <channel>\x00d<namespace>[$$<p|h><collection>]\x00<key>
+type dataKey struct {
+	channel    string
+	namespace  string
+	collection string
+	pvtPrefix  byte
+	key        string
+}
+
+func splitDataKey(key []byte) (*dataKey, error) {
+	channelKey := bytes.SplitN(key, []byte{0x00}, 2)
+	if len(channelKey) != 2 || len(channelKey[1]) == 0 || channelKey[1][0] != 'd' {
+		return nil, fmt.Errorf("invalid state data key [%x]", key)
+	}
+	nsKey := bytes.SplitN(channelKey[1][1:], []byte{0x00}, 2)
+	if len(nsKey) != 2 {
+		return nil, fmt.Errorf("invalid state data key [%x]", key)
+	}
+	dk := &dataKey{channel: string(channelKey[0]), namespace: string(nsKey[0]), key: string(nsKey[1])}
+	if isPvtdataNs(nsKey[0]) {
+		nsColl := strings.SplitN(dk.namespace, nsJoiner, 2)
+		if len(nsColl[1]) == 0 {
+			return nil, fmt.Errorf("invalid private data namespace [%s]", dk.namespace)
+		}
+		dk.namespace = nsColl[0]
+		dk.pvtPrefix = nsColl[1][0]
+		dk.collection = nsColl[1][1:]
+	}
+	return dk, nil
+}
+
+// decodeDataRecord decodes a data entry, the lifecycle fields are left to the caller
+func decodeDataRecord(key []byte, value []byte) (*Record, error) {
+	dk, err := splitDataKey(key)
+	if err != nil {
+		return nil, err
+	}
+	versionedValue, err := utils.DecodeValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the value of [%s], error=[%v]", dk.key, err)
+	}
+	metadata, err := utils.Deserialize(versionedValue.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the metadata of [%s], error=[%v]", dk.key, err)
+	}
+	r := &Record{
+		Channel:    dk.channel,
+		Namespace:  dk.namespace,
+		Collection: dk.collection,
+		Hashed:     dk.pvtPrefix == hashDataPrefix[0],
+		Key:        dk.key,
+		Value:      versionedValue.Value,
+		Version:    versionedValue.Version,
+		Metadata:   metadata,
+	}
+	if !r.Hashed {
+		r.Composite, _ = SplitCompositeKey(r.Key)
+	}
+	return r, nil
+}
+
+// decodeLifecycleRecord decodes a _lifecycle data entry including its lifecycle field
+func decodeLifecycleRecord(key []byte, value []byte) (*Record, error) {
+	r, err := decodeDataRecord(key, value)
+	if err != nil {
+		return nil, err
+	}
+	if r.Hashed {
+		return r, nil
+	}
+	if r.Lifecycle, err = decodeLifecycleField(r.Key, r.Value); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func decodeLifecycleField(key string, value []byte) (*LifecycleField, error) {
+	chunks := strings.Split(key, "/")
+	if len(chunks) < 3 {
+		return nil, fmt.Errorf("unknown lifecycle key [%s]", key)
+	}
+	field := &LifecycleField{Space: chunks[0], Infix: chunks[1], Name: chunks[2]}
+	switch {
+	case field.Infix == "metadata" && len(chunks) == 3:
+		metadata := &lb.StateMetadata{}
+		if err := goproto.Unmarshal(value, metadata); err != nil {
+			return nil, fmt.Errorf("cannot decode lifecycle metadata [%s], error=[%v]", key, err)
+		}
+		field.Value = metadata
+		return field, nil
+	case field.Infix == "fields" && len(chunks) == 4:
+		field.Field = chunks[3]
+	default:
+		return nil, fmt.Errorf("unknown lifecycle key [%s]", key)
+	}
+
+	stateData := &lb.StateData{}
+	if err := goproto.Unmarshal(value, stateData); err != nil {
+		return nil, fmt.Errorf("cannot decode lifecycle field [%s], error=[%v]", key, err)
+	}
+	var msg goproto.Message
+	switch field.Field {
+	case "Sequence":
+		field.Value = stateData.GetInt64()
+		return field, nil
+	case "PackageID":
+		field.Value = stateData.GetString_()
+		return field, nil
+	case "EndorsementInfo":
+		msg = &lb.ChaincodeEndorsementInfo{}
+	case "ValidationInfo":
+		msg = &lb.ChaincodeValidationInfo{}
+	case "Collections":
+		msg = &pb.CollectionConfigPackage{}
+	default:
+		field.Value = stateData
+		return field, nil
+	}
+	if _, ok := stateData.Type.(*lb.StateData_Bytes); !ok {
+		return nil, fmt.Errorf("expected lifecycle field [%s] to encode a value of type []byte, but was %T", key, stateData.Type)
+	}
+	if err := goproto.Unmarshal(stateData.GetBytes(), msg); err != nil {
+		return nil, fmt.Errorf("cannot decode lifecycle field [%s], error=[%v]", key, err)
+	}
+	field.Value = msg
+	return field, nil
+}
+
+// decodeChannelRecord decodes the entries of the internal namespace of a channel (format and savepoint)
+func decodeChannelRecord(key []byte, value []byte) *Record {
+	channelKey := bytes.SplitN(key, []byte{0x00}, 2)
+	return &Record{Channel: string(channelKey[0]), Key: string(channelKey[1]), Value: value}
+}
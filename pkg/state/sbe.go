@@ -0,0 +1,165 @@
+package state
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/policy"
+)
+
+// ValidationParameterKey is the metadata entry holding the key-level endorsement policy of a key
+var ValidationParameterKey = pb.MetaDataKeys_VALIDATION_PARAMETER.String()
+
+// ValidationParameter returns the key-level endorsement policy of the record, nil when it has none
+func (r *Record) ValidationParameter() (*common.SignaturePolicyEnvelope, error) {
+	value, ok := r.Metadata[ValidationParameterKey]
+	if !ok {
+		return nil, nil
+	}
+	spe := &common.SignaturePolicyEnvelope{}
+	if err := proto.Unmarshal(value, spe); err != nil {
+		return nil, fmt.Errorf("cannot decode the validation parameter of [%s], error=[%v]", r.Key, err)
+	}
+	return spe, nil
+}
+
+// formatMetadata renders every metadata entry sorted by name, the validation parameter as a policy expression
+func formatMetadata(metadata map[string][]byte) string {
+	names := make([]string, 0, len(metadata))
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		value := metadata[name]
+		var rendered string
+		switch {
+		case name == ValidationParameterKey:
+			expression, err := policy.ExpressionFromBytes(value)
+			if err != nil {
+				rendered = fmt.Sprintf("%x (%s)", value, err)
+			} else {
+				rendered = expression
+			}
+		case utf8.Valid(value):
+			rendered = string(value)
+		default:
+			rendered = hex.EncodeToString(value)
+		}
+		fmt.Fprintf(&sb, "\n\t\tkey: %s, value: %s", name, rendered)
+	}
+	return sb.String()
+}
+
+// KeyPolicy is a key protected by a key-level endorsement policy
+type KeyPolicy struct {
+	Collection string `json:"collection,omitempty"`
+	Key        string `json:"key"` // hex encoded for hashed private keys
+	Version    string `json:"version"`
+	Policy     string `json:"policy"`
+}
+
+// SBEReport lists the keys with a key-level endorsement (state-based endorsement) policy per namespace
+type SBEReport struct {
+	Channel    string                 `json:"channel"`
+	Namespaces map[string][]KeyPolicy `json:"namespaces"`
+}
+
+// NewSBEReport collects the keys of a channel that carry a VALIDATION_PARAMETER in their metadata
+func NewSBEReport(db *leveldb.DB, channel string) (*SBEReport, error) {
+	f, err := format.Detect(db)
+	if err != nil {
+		return nil, err
+	}
+	report := &SBEReport{Channel: channel, Namespaces: map[string][]KeyPolicy{}}
+	iter := db.NewIterator(lutil.BytesPrefix(append([]byte(channel), 0x00)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := ParseKVWithFormat(iter.Key(), iter.Value(), channel, f)
+		if err != nil {
+			return nil, err
+		}
+		if kv == nil || kv.Type() == FormatVersion || kv.Type() == SavePoint {
+			continue
+		}
+		record, err := kv.Decode()
+		if err != nil {
+			return nil, err
+		}
+		spe, err := record.ValidationParameter()
+		if err != nil {
+			return nil, err
+		}
+		if spe == nil {
+			continue
+		}
+		expression, err := policy.Expression(spe)
+		if err != nil {
+			return nil, fmt.Errorf("cannot render the validation parameter of [%s], error=[%v]", record.Key, err)
+		}
+		key := displayKey(record.Key)
+		if record.Hashed {
+			key = hex.EncodeToString([]byte(record.Key))
+		}
+		report.Namespaces[record.Namespace] = append(report.Namespaces[record.Namespace], KeyPolicy{
+			Collection: record.Collection,
+			Key:        key,
+			Version:    record.Version.String(),
+			Policy:     expression,
+		})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Keys returns the number of keys with a key-level endorsement policy
+func (r *SBEReport) Keys() int {
+	n := 0
+	for _, keys := range r.Namespaces {
+		n += len(keys)
+	}
+	return n
+}
+
+// JSON returns the report encoded as indented JSON
+func (r *SBEReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary returns a plain-text summary of the report
+func (r *SBEReport) Summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "channel: %s\n", r.Channel)
+	fmt.Fprintf(&sb, "keys with key-level endorsement policies: %d\n", r.Keys())
+
+	namespaces := make([]string, 0, len(r.Namespaces))
+	for ns := range r.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		fmt.Fprintf(&sb, "\n%s: %d\n", ns, len(r.Namespaces[ns]))
+		for _, kp := range r.Namespaces[ns] {
+			key := kp.Key
+			if kp.Collection != "" {
+				key = kp.Collection + "/" + key
+			}
+			fmt.Fprintf(&sb, "\t%s  %s\n", key, kp.Policy)
+		}
+	}
+	return sb.String()
+}
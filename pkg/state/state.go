@@ -14,6 +14,7 @@ import (
 	lb "github.com/hyperledger/fabric-protos-go/peer/lifecycle"
 	"github.com/hyperledger/fabric/core/chaincode/lifecycle"
 	"github.com/pkg/errors"
+	"github.com/the-medium/ledger-parser/pkg/format"
 )
 
 const (
@@ -70,7 +71,8 @@ func getDataNSKey(prefixedKey []byte) (namespace string, realKey string, pvtData
 	bNamespace := splited[0]
 	if isPvtdataNs(bNamespace) { // has private data collection
 		splitedNS := bytes.SplitN(bNamespace, []byte("$$"), 2)
-		bNamespace = append(splitedNS[0], splitedNS[1][1:]...)
+		// copy, appending to the subslice would overwrite the key
+		bNamespace = append(append([]byte{}, splitedNS[0]...), splitedNS[1][1:]...)
 		pvtDataPrefix = splitedNS[1][0]
 	}
 
@@ -220,10 +222,23 @@ func handleUCCKV(key []byte, value []byte) (kvSet KVSet) {
 // ParseKV returns kvSet that converts byte represented KV to human readable string.
 // if empty string is given for parameter channel, it parses for KV from all channels.
 func ParseKV(key []byte, value []byte, channel string) (kvSet KVSet, err error) {
+	return ParseKVWithFormat(key, value, channel, format.V2_0)
+}
+
+// ParseKVWithFormat is ParseKV for a stateLeveldb written in the given data format.
+// Entries of a 1.x db are translated into the 2.0 encoding, so the returned kvSet
+// holds the translated key and value.
+func ParseKVWithFormat(key []byte, value []byte, channel string, f format.Version) (kvSet KVSet, err error) {
 	nsKey := bytes.SplitN(key, []byte{0x00}, 2)
 	if string(nsKey[0]) != channel && channel != "" {
 		return nil, nil
 	}
+	if f == format.V1_4 {
+		if key, value, err = fromV14(key, value); err != nil {
+			return nil, err
+		}
+		nsKey = bytes.SplitN(key, []byte{0x00}, 2)
+	}
 
 	internalKey := nsKey[1]
 	prefix := internalKey[0]
@@ -1,11 +1,31 @@
 package state
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	lb "github.com/hyperledger/fabric-protos-go/peer/lifecycle"
+	"github.com/hyperledger/fabric/common/policydsl"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/hyperledger/fabric/protoutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/the-medium/ledger-parser/internal/testutil"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/index"
 )
 
 func TestParseKV(t *testing.T) {
@@ -28,3 +48,462 @@ func TestParseKV(t *testing.T) {
 	err = iter.Error()
 	assert.NoError(t, err)
 }
+
+func TestParseKVWithFormatV14(t *testing.T) {
+	height := version.NewHeight(3, 1)
+	valueV13, err := utils.EncodeValue(&statedb.VersionedValue{Value: []byte("v1"), Version: height})
+	assert.NoError(t, err)
+
+	for _, value := range [][]byte{
+		append([]byte{0x00}, valueV13...),         // v1.3+
+		append(height.ToBytes(), []byte("v1")...), // before v1.3
+	} {
+		key := []byte("mychannel\x00mycc\x00key1")
+		kv, err := ParseKVWithFormat(key, value, "", format.V1_4)
+		assert.NoError(t, err)
+		assert.Equal(t, UserPublic, kv.Type())
+		assert.Equal(t, []byte("mychannel\x00dmycc\x00key1"), kv.Key())
+		assert.Equal(t, "v1", kv.Value())
+		assert.Equal(t, []byte("mychannel\x00mycc\x00key1"), key)
+	}
+
+	kv, err := ParseKVWithFormat([]byte("mychannel\x00\x00"), height.ToBytes(), "", format.V1_4)
+	assert.NoError(t, err)
+	assert.Equal(t, SavePoint, kv.Type())
+}
+
+func encodeValue(t *testing.T, value []byte, blockNum uint64, metadata []byte) []byte {
+	b, err := utils.EncodeValue(&statedb.VersionedValue{Value: value, Version: version.NewHeight(blockNum, 0), Metadata: metadata})
+	assert.NoError(t, err)
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	metadata, err := utils.Serialize([]*kvrwset.KVMetadataEntry{{Name: "VALIDATION_PARAMETER", Value: []byte("policy")}})
+	assert.NoError(t, err)
+	key := []byte("mychannel\x00dmycc\x00key1")
+	kv, err := ParseKV(key, encodeValue(t, []byte("v1"), 4, metadata), "")
+	assert.NoError(t, err)
+	r, err := kv.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, &Record{
+		Channel:   "mychannel",
+		Namespace: "mycc",
+		Key:       "key1",
+		Value:     []byte("v1"),
+		Version:   version.NewHeight(4, 0),
+		Metadata:  map[string][]byte{"VALIDATION_PARAMETER": []byte("policy")},
+	}, r)
+
+	// decoding leaves the key of private data untouched
+	key = []byte("mychannel\x00dmycc$$pcoll1\x00key1")
+	kv, err = ParseKV(key, encodeValue(t, []byte("secret"), 5, nil), "")
+	assert.NoError(t, err)
+	kv.Value()
+	r, err = kv.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("mychannel\x00dmycc$$pcoll1\x00key1"), key)
+	assert.Equal(t, "mycc", r.Namespace)
+	assert.Equal(t, "coll1", r.Collection)
+	assert.False(t, r.Hashed)
+	assert.Equal(t, []byte("secret"), r.Value)
+
+	kv, err = ParseKV([]byte("mychannel\x00dmycc$$hcoll1\x00\x01\x02"), encodeValue(t, []byte{0x03}, 5, nil), "")
+	assert.NoError(t, err)
+	r, err = kv.Decode()
+	assert.NoError(t, err)
+	assert.True(t, r.Hashed)
+	assert.Equal(t, "\x01\x02", r.Key)
+
+	sequence := protoutil.MarshalOrPanic(&lb.StateData{Type: &lb.StateData_Int64{Int64: 2}})
+	kv, err = ParseKV([]byte("mychannel\x00d_lifecycle\x00namespaces/fields/mycc/Sequence"), encodeValue(t, sequence, 6, nil), "")
+	assert.NoError(t, err)
+	r, err = kv.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, &LifecycleField{Space: "namespaces", Infix: "fields", Name: "mycc", Field: "Sequence", Value: int64(2)}, r.Lifecycle)
+
+	endorsement := protoutil.MarshalOrPanic(&lb.StateData{Type: &lb.StateData_Bytes{
+		Bytes: protoutil.MarshalOrPanic(&lb.ChaincodeEndorsementInfo{Version: "1.0", EndorsementPlugin: "escc"}),
+	}})
+	kv, err = ParseKV([]byte("mychannel\x00d_lifecycle$$pimplicit_org_Org1MSP\x00namespaces/fields/mycc#2/EndorsementInfo"), encodeValue(t, endorsement, 6, nil), "")
+	assert.NoError(t, err)
+	r, err = kv.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, "implicit_org_Org1MSP", r.Collection)
+	assert.Equal(t, "mycc#2", r.Lifecycle.Name)
+	assert.Equal(t, "1.0", r.Lifecycle.Value.(*lb.ChaincodeEndorsementInfo).Version)
+
+	kv, err = ParseKV([]byte("mychannel\x00d_lifecycle\x00namespaces/fields/mycc/Sequence"), []byte{0xff}, "")
+	assert.NoError(t, err)
+	_, err = kv.Decode()
+	assert.Error(t, err)
+
+	kv, err = ParseKV([]byte("mychannel\x00s"), version.NewHeight(6, 2).ToBytes(), "")
+	assert.NoError(t, err)
+	r, err = kv.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, version.NewHeight(6, 2), r.Version)
+}
+
+func TestStateReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(dir, nil)
+	assert.NoError(t, err)
+
+	keyHash := sha256.Sum256([]byte("secret"))
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	for _, k := range []string{"a", "b", "b1", "c"} {
+		assert.NoError(t, db.Put([]byte("mychannel\x00dmycc\x00"+k), encodeValue(t, []byte("value of "+k), 1, nil), nil))
+	}
+	assert.NoError(t, db.Put([]byte("mychannel\x00dmycc1\x00a"), encodeValue(t, []byte("other namespace"), 1, nil), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00dmycc$$pcoll1\x00secret"), encodeValue(t, []byte("pvt"), 2, nil), nil))
+	assert.NoError(t, db.Put(append([]byte("mychannel\x00dmycc$$hcoll1\x00"), keyHash[:]...), encodeValue(t, []byte("hash"), 2, nil), nil))
+
+	// an unknown format is not read as 2.0
+	assert.NoError(t, db.Put(format.FormatKey, []byte("9.9"), nil))
+	_, err = NewStateReader(db)
+	assert.Error(t, err)
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+
+	r, err := NewStateReader(db)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	v, err := r.Get("mychannel", "mycc", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value of b"), v.Value)
+	assert.Equal(t, version.NewHeight(1, 0), v.Version)
+	v, err = r.Get("mychannel", "mycc", "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	v, err = r.GetPrivate("mychannel", "mycc", "coll1", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("pvt"), v.Value)
+	v, err = r.GetPrivateHash("mychannel", "mycc", "coll1", keyHash[:])
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hash"), v.Value)
+
+	rangeKeys := func(start, end string) []string {
+		it := r.GetRange("mychannel", "mycc", start, end)
+		defer it.Close()
+		keys := []string{}
+		for {
+			kv, err := it.Next()
+			assert.NoError(t, err)
+			if kv == nil {
+				return keys
+			}
+			keys = append(keys, kv.Key)
+		}
+	}
+	assert.Equal(t, []string{"b", "b1"}, rangeKeys("b", "c"))
+	assert.Equal(t, []string{"a", "b", "b1", "c"}, rangeKeys("", ""))
+}
+
+func TestCompositeKey(t *testing.T) {
+	key, err := CreateCompositeKey("owner~asset", []string{"alice", "asset1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "\x00owner~asset\x00alice\x00asset1\x00", key)
+	ck, ok := SplitCompositeKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, &CompositeKey{ObjectType: "owner~asset", Attributes: []string{"alice", "asset1"}}, ck)
+	assert.Equal(t, "owner~asset[alice, asset1]", ck.String())
+
+	for _, simple := range []string{"asset1", "\x00", "\x00\U0010ffffinitialized", ""} {
+		_, ok := SplitCompositeKey(simple)
+		assert.False(t, ok, simple)
+	}
+	_, err = CreateCompositeKey("owner", []string{"a\x00b"})
+	assert.Error(t, err)
+
+	kv, err := ParseKV([]byte("mychannel\x00dmycc\x00"+key), encodeValue(t, []byte("1"), 1, nil), "")
+	assert.NoError(t, err)
+	r, err := kv.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, ck, r.Composite)
+
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(dir, nil)
+	assert.NoError(t, err)
+	for _, attrs := range [][]string{{"alice", "asset1"}, {"alice", "asset2"}, {"alicia", "asset3"}, {"bob", "asset4"}} {
+		k, err := CreateCompositeKey("owner~asset", attrs)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Put([]byte("mychannel\x00dmycc\x00"+k), encodeValue(t, []byte(attrs[1]), 1, nil), nil))
+		assert.NoError(t, db.Put([]byte("mychannel\x00dmycc$$pcoll1\x00"+k), encodeValue(t, []byte(attrs[1]), 1, nil), nil))
+	}
+	assert.NoError(t, db.Put([]byte("mychannel\x00dmycc\x00alice"), encodeValue(t, []byte("simple"), 1, nil), nil))
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	r2, err := NewStateReader(db)
+	assert.NoError(t, err)
+	defer r2.Close()
+
+	values := func(it *RangeIterator, err error) []string {
+		assert.NoError(t, err)
+		defer it.Close()
+		values := []string{}
+		for {
+			kv, err := it.Next()
+			assert.NoError(t, err)
+			if kv == nil {
+				return values
+			}
+			values = append(values, string(kv.Value))
+		}
+	}
+	assert.Equal(t, []string{"asset1", "asset2"}, values(r2.GetByPartialCompositeKey("mychannel", "mycc", "owner~asset", []string{"alice"})))
+	assert.Equal(t, []string{"asset1", "asset2", "asset3", "asset4"}, values(r2.GetByPartialCompositeKey("mychannel", "mycc", "owner~asset", nil)))
+	assert.Equal(t, []string{"asset4"}, values(r2.GetPrivateByPartialCompositeKey("mychannel", "mycc", "coll1", "owner~asset", []string{"bob"})))
+}
+
+func TestSBEReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sbe")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(dir, nil)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	spe, err := proto.Marshal(policydsl.SignedByAnyMember([]string{"Org1MSP", "Org2MSP"}))
+	assert.NoError(t, err)
+	metadata, err := utils.Serialize([]*kvrwset.KVMetadataEntry{
+		{Name: "VALIDATION_PARAMETER", Value: spe},
+		{Name: "custom", Value: []byte("note")},
+	})
+	assert.NoError(t, err)
+	keyHash := sha256.Sum256([]byte("secret"))
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00dmycc\x00a"), encodeValue(t, []byte("1"), 1, metadata), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00dmycc\x00b"), encodeValue(t, []byte("2"), 1, nil), nil))
+	assert.NoError(t, db.Put(append([]byte("mychannel\x00dmycc$$hcoll1\x00"), keyHash[:]...), encodeValue(t, []byte("hash"), 2, metadata), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00s"), version.NewHeight(2, 0).ToBytes(), nil))
+
+	assert.Equal(t, "\n\t\tkey: VALIDATION_PARAMETER, value: OR('Org1MSP.member', 'Org2MSP.member')\n\t\tkey: custom, value: note",
+		formatMetadata(map[string][]byte{"VALIDATION_PARAMETER": spe, "custom": []byte("note")}))
+
+	report, err := NewSBEReport(db, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Keys())
+	assert.Equal(t, map[string][]KeyPolicy{"mycc": {
+		{Key: "a", Version: "{BlockNum: 1, TxNum: 0}", Policy: "OR('Org1MSP.member', 'Org2MSP.member')"},
+		{Collection: "coll1", Key: hex.EncodeToString(keyHash[:]), Version: "{BlockNum: 2, TxNum: 0}", Policy: "OR('Org1MSP.member', 'Org2MSP.member')"},
+	}}, report.Namespaces)
+	assert.Contains(t, report.Summary(), "mycc: 2\n\ta  OR('Org1MSP.member', 'Org2MSP.member')\n")
+}
+
+func TestContentType(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write([]byte(`{"owner":"alice"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	// a message with field 1 = "asset1", field 2 = 150 and a repeated nested message 3
+	nested := protoutil.MarshalOrPanic(&lb.StateData{Type: &lb.StateData_Int64{Int64: 7}})
+	msg := append([]byte{0x0a, 0x06}, "asset1"...)
+	msg = append(msg, 0x10, 0x96, 0x01)
+	for i := 0; i < 2; i++ {
+		msg = append(append(msg, 0x1a, byte(len(nested))), nested...)
+	}
+
+	for _, c := range []struct {
+		value    []byte
+		expected ContentType
+		rendered string
+	}{
+		{[]byte(`{"owner":"alice"}`), JSON, `{"owner":"alice"}`},
+		{[]byte("plain text\n"), Text, "plain text\n"},
+		{[]byte{}, Text, ""},
+		{gz.Bytes(), Gzip, `{"owner":"alice"}`},
+		{msg, Protobuf, `{"1":"asset1","2":150,"3":[{"1":7},{"1":7}]}`},
+		{[]byte{0xff, 0x00, 0x07}, Binary, "ff0007"},
+	} {
+		assert.Equal(t, c.expected, DetectContentType(c.value), c.rendered)
+		contentType, rendered := NewValueRenderer().Render("mycc", c.value)
+		assert.Equal(t, c.expected, contentType)
+		assert.Equal(t, c.rendered, rendered)
+	}
+
+	r := NewValueRenderer()
+	r.SetContentType("mycc", Binary)
+	contentType, rendered := r.Render("mycc", []byte("abc"))
+	assert.Equal(t, Binary, contentType)
+	assert.Equal(t, "616263", rendered)
+	// a value that does not decode as the override falls back to hex
+	r.SetContentType("mycc", Protobuf)
+	_, rendered = r.Render("mycc", []byte{0xff})
+	assert.Equal(t, "ff", rendered)
+	r.SetContentType("mycc", Auto)
+	assert.Equal(t, Text, r.ContentType("mycc", []byte("abc")))
+
+	ct, err := ParseContentType("protobuf")
+	assert.NoError(t, err)
+	assert.Equal(t, Protobuf, ct)
+	_, err = ParseContentType("xml")
+	assert.EqualError(t, err, "unknown content type [xml]")
+
+	r = NewValueRenderer()
+	r.SetContentType("proto", Protobuf)
+	// "(A" is printable, as a message it is field 5 = 65
+	kv, err := ParseKV([]byte("mychannel\x00dproto\x00key1"), encodeValue(t, []byte("(A"), 1, nil), "")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"5":65}`, kv.(*UserPublicKV).RenderedValue(r))
+	assert.Equal(t, "(A", kv.(*UserPublicKV).RenderedValue(nil))
+	// Value stays the raw value
+	assert.Equal(t, "(A", kv.Value())
+	kv, err = ParseKV([]byte("mychannel\x00dmycc\x00key1"), encodeValue(t, []byte("(A"), 1, nil), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "(A", kv.(*UserPublicKV).RenderedValue(r))
+	kv, err = ParseKV([]byte("mychannel\x00dmycc\x00key1"), encodeValue(t, []byte{0xff}, 1, nil), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "\xff", kv.Value())
+	assert.Equal(t, "ff", kv.(*UserPublicKV).RenderedValue(nil))
+}
+
+func TestDigestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	v20, err := leveldb.OpenFile(dir+"/v20", nil)
+	assert.NoError(t, err)
+	defer v20.Close()
+	v14, err := leveldb.OpenFile(dir+"/v14", nil)
+	assert.NoError(t, err)
+	defer v14.Close()
+
+	metadata, err := utils.Serialize([]*kvrwset.KVMetadataEntry{{Name: "VALIDATION_PARAMETER", Value: []byte("policy")}})
+	assert.NoError(t, err)
+	entries := []struct {
+		key, value string
+		metadata   []byte
+	}{
+		{"mycc\x00key1", "v1", nil},
+		{"mycc\x00key2", "v2", metadata},
+		{"mycc$$hcoll1\x00" + string([]byte{0xab, 0xcd}), "valuehash", nil},
+		{"other\x00key1", "v1", nil},
+	}
+	assert.NoError(t, v20.Put(format.FormatKey, []byte("2.0"), nil))
+	assert.NoError(t, v20.Put([]byte("mychannel\x00s"), version.NewHeight(9, 0).ToBytes(), nil))
+	assert.NoError(t, v14.Put([]byte("mychannel\x00\x00"), version.NewHeight(9, 0).ToBytes(), nil))
+	for _, e := range entries {
+		value := encodeValue(t, []byte(e.value), 4, e.metadata)
+		assert.NoError(t, v20.Put([]byte("mychannel\x00d"+e.key), value, nil))
+		assert.NoError(t, v14.Put([]byte("mychannel\x00"+e.key), append([]byte{0x00}, value...), nil))
+	}
+	// only member peers hold the cleartext, the digests still agree
+	assert.NoError(t, v20.Put([]byte("mychannel\x00dmycc$$pcoll1\x00secret"), encodeValue(t, []byte("s"), 4, nil), nil))
+
+	expected, err := NewDigestReport(v20, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, version.NewHeight(9, 0).String(), expected.SavePoint)
+	assert.Len(t, expected.Namespaces, 2)
+	assert.Equal(t, 2, expected.Namespaces["mycc"].Keys)
+	assert.Equal(t, 1, expected.Namespaces["mycc"].Collections["coll1"].Keys)
+	assert.Len(t, expected.Namespaces["mycc"].Digest.Digest, 64)
+	report, err := NewDigestReport(v14, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, report)
+
+	assert.NoError(t, v14.Put([]byte("mychannel\x00mycc\x00key2"), append([]byte{0x00}, encodeValue(t, []byte("v2"), 4, nil)...), nil))
+	report, err = NewDigestReport(v14, "mychannel")
+	assert.NoError(t, err)
+	assert.NotEqual(t, expected.Namespaces["mycc"].Digest, report.Namespaces["mycc"].Digest)
+	assert.Equal(t, expected.Namespaces["mycc"].Collections, report.Namespaces["mycc"].Collections)
+	assert.Equal(t, expected.Namespaces["other"], report.Namespaces["other"])
+
+	j, err := expected.JSON()
+	assert.NoError(t, err)
+	assert.Contains(t, string(j), `"other":{"keys":1,"digest":"`)
+}
+
+func configEnvelope(t *testing.T, sequence uint64, orgs ...string) *common.ConfigEnvelope {
+	hashing, err := proto.Marshal(&common.HashingAlgorithm{Name: "SHA256"})
+	assert.NoError(t, err)
+	application := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{}, ModPolicy: "Admins"}
+	for _, org := range orgs {
+		application.Groups[org] = &common.ConfigGroup{Values: map[string]*common.ConfigValue{"MSP": {Value: []byte{}}}}
+	}
+	return &common.ConfigEnvelope{Config: &common.Config{
+		Sequence: sequence,
+		ChannelGroup: &common.ConfigGroup{
+			Groups: map[string]*common.ConfigGroup{"Application": application},
+			Values: map[string]*common.ConfigValue{"HashingAlgorithm": {Value: hashing}},
+		},
+	}}
+}
+
+func TestChannelConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "channelconfig")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	ts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	configTx := func(txID string, env *common.ConfigEnvelope) []*testutil.Tx {
+		data, err := proto.Marshal(env)
+		assert.NoError(t, err)
+		return []*testutil.Tx{{TxID: txID, ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: ts, Data: data}}
+	}
+	latest := configEnvelope(t, 1, "Org1MSP", "Org2MSP")
+	blocks, err := testutil.NewChain(true,
+		configTx("genesis", configEnvelope(t, 0, "Org1MSP")),
+		[]*testutil.Tx{{TxID: "tx1", ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts, MSPID: "Org1MSP", Chaincode: "mycc"}},
+		configTx("update", latest),
+		[]*testutil.Tx{{TxID: "tx2", ChannelID: "mychannel", Type: common.HeaderType_ENDORSER_TRANSACTION, Timestamp: ts, MSPID: "Org1MSP", Chaincode: "mycc"}},
+	)
+	assert.NoError(t, err)
+	base := filepath.Join(root, "ledgersData", "chains")
+	assert.NoError(t, testutil.WriteLedger(filepath.Join(base, "chains"), filepath.Join(base, "index"), "mychannel", true, blocks...))
+	store, err := index.OpenBlockStore(root)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	db, err := leveldb.OpenFile(filepath.Join(root, "ledgersData", "stateLeveldb"), nil)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	key := []byte("mychannel\x00d\x00" + ChannelConfigKey)
+	latestBytes, err := proto.Marshal(latest)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put(key, encodeValue(t, latestBytes, 2, nil), nil))
+
+	value, err := db.Get(key, nil)
+	assert.NoError(t, err)
+	kv, err := ParseKV(key, value, "")
+	assert.NoError(t, err)
+	assert.Equal(t, ChannelConfig, kv.Type())
+	config, err := kv.(*ChannelConfigKV).Config()
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(latest.Config, config))
+	// values are decoded instead of being rendered as base64
+	assert.Contains(t, kv.Value(), `"name": "SHA256"`)
+
+	reader, err := NewStateReader(db)
+	assert.NoError(t, err)
+	c, err := CompareChannelConfig(reader, store, "mychannel")
+	assert.NoError(t, err)
+	assert.True(t, c.OK(), c.Differences)
+	assert.Equal(t, uint64(2), c.BlockNum)
+	assert.Equal(t, uint64(1), c.StateSequence)
+
+	stale, err := proto.Marshal(configEnvelope(t, 0, "Org1MSP"))
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put(key, encodeValue(t, stale, 0, nil), nil))
+	c, err = CompareChannelConfig(reader, store, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"the state was written by block [0], not by config block [2]",
+		"sequence [0] differs from the sequence [1] of the config block",
+		"/Channel/Application/Org2MSP: only in block",
+	}, c.Differences)
+
+	// an undecodable value is reported instead of panicking
+	kv, err = ParseKV(key, []byte{0xff}, "")
+	assert.NoError(t, err)
+	_, err = kv.(*ChannelConfigKV).Config()
+	assert.Error(t, err)
+	assert.NotPanics(t, kv.Print)
+}
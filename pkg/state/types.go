@@ -3,12 +3,10 @@ package state
 import (
 	"bytes"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"strings"
 
-	"github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
 	"github.com/the-medium/ledger-parser/internal/utils"
 )
 
@@ -23,6 +21,7 @@ const (
 )
 
 type KVSet interface {
+	Decode() (*Record, error)
 	Describe() string
 	Key() []byte
 	Print()
@@ -36,6 +35,11 @@ type ChannelConfigKV struct {
 	describe string
 }
 
+// Decode returns the typed record of the entry
+func (kv ChannelConfigKV) Decode() (*Record, error) {
+	return decodeDataRecord(kv.key, kv.value)
+}
+
 func (kv ChannelConfigKV) Describe() string {
 	return kv.describe
 }
@@ -45,27 +49,16 @@ func (kv ChannelConfigKV) Key() []byte {
 }
 
 func (kv ChannelConfigKV) Print() {
-	realKey := "CHANNEL_CONFIG_ENV_BYTES"
-
-	var versionedValue, _ = utils.DecodeValue(kv.value)
-
-	ccenv := &common.ConfigEnvelope{}
-	err := proto.Unmarshal(versionedValue.Value, ccenv)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+	fmt.Printf("<%s>\n", kv.describe)
+	fmt.Printf("channel: %s\n", bytes.SplitN(kv.key, []byte{0x00}, 2)[0])
+	fmt.Printf("RealKey: %s\n", ChannelConfigKey)
 
-	// realValue := ccenv.String()
-	b, err := json.MarshalIndent(ccenv, "\t\t", "  ")
+	r, err := kv.Decode()
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	fmt.Printf("<%s>\n", kv.describe)
-	fmt.Printf("channel: %s\n", bytes.SplitN(kv.key, []byte{0x00}, 2)[0])
-	fmt.Printf("RealKey: %s\n", realKey)
-	fmt.Printf("Value\n\tvalue:\n\t\t%s\n\tversion: %s\n\tmetadata:%s\n", b, versionedValue.Version.String(), versionedValue.Metadata)
+	fmt.Printf("Value\n\tvalue:\n\t\t%s\n\tversion: %s\n\tmetadata:%s\n", kv.Value(), r.Version.String(), formatMetadata(r.Metadata))
 }
 
 func (kv ChannelConfigKV) Type() int {
@@ -73,19 +66,10 @@ func (kv ChannelConfigKV) Type() int {
 }
 
 func (kv ChannelConfigKV) Value() string {
-	var versionedValue, _ = utils.DecodeValue(kv.value)
-
-	ccenv := &common.ConfigEnvelope{}
-	err := proto.Unmarshal(versionedValue.Value, ccenv)
+	b, err := kv.JSON()
 	if err != nil {
 		return err.Error()
 	}
-
-	b, err := json.MarshalIndent(ccenv, "\t\t", "  ")
-	if err != nil {
-		return err.Error()
-	}
-
 	return string(b)
 }
 
@@ -95,6 +79,11 @@ type SystemPublicKV struct {
 	describe string
 }
 
+// Decode returns the typed record of the entry
+func (kv SystemPublicKV) Decode() (*Record, error) {
+	return decodeLifecycleRecord(kv.key, kv.value)
+}
+
 func (kv SystemPublicKV) Describe() string {
 	return kv.describe
 }
@@ -144,6 +133,11 @@ type SystemPrivateKV struct {
 	describe string
 }
 
+// Decode returns the typed record of the entry
+func (kv SystemPrivateKV) Decode() (*Record, error) {
+	return decodeLifecycleRecord(kv.key, kv.value)
+}
+
 func (kv SystemPrivateKV) Describe() string {
 	return kv.describe
 }
@@ -229,6 +223,11 @@ type UserPublicKV struct {
 	describe string
 }
 
+// Decode returns the typed record of the entry
+func (kv UserPublicKV) Decode() (*Record, error) {
+	return decodeDataRecord(kv.key, kv.value)
+}
+
 func (kv UserPublicKV) Describe() string {
 	return kv.describe
 }
@@ -238,35 +237,29 @@ func (kv UserPublicKV) Key() []byte {
 }
 
 func (kv UserPublicKV) Print() {
+	kv.PrintWith(nil)
+}
+
+// PrintWith prints the entry with its value rendered by r, see ValueRenderer
+func (kv UserPublicKV) PrintWith(r *ValueRenderer) {
 	_, realKey, _ := getDataNSKey(bytes.SplitN(kv.key, []byte{0x00}, 2)[1])
 	var versionedValue, _ = utils.DecodeValue(kv.value)
 
 	fmt.Printf("<%s>\n", kv.describe)
 	fmt.Printf("channel: %s\n", bytes.SplitN(kv.key, []byte{0x00}, 2)[0])
-	fmt.Printf("RealKey: %s\n", realKey)
+	fmt.Printf("RealKey: %s\n", displayKey(realKey))
 	metaResult, err := utils.Deserialize(versionedValue.Metadata)
 	if err != nil {
 		fmt.Printf("Deserialize metadata err: %s\n", err)
 	}
+	contentType, realValue := renderUserValue(r, kv.key, versionedValue.Value)
 	if len(metaResult) == 0 {
-		fmt.Printf("Value\n\tvalue: %s\n\tversion: %s\n", versionedValue.Value, versionedValue.Version.String())
+		fmt.Printf("Value\n\tvalue (%s): %s\n\tversion: %s\n", contentType, realValue, versionedValue.Version.String())
 		fmt.Println()
 		return
 	}
-	msgMetadata := ""
-	for key, value := range metaResult {
-		if key == "VALIDATION_PARAMETER" {
-			spe := &common.SignaturePolicyEnvelope{}
-			err := proto.Unmarshal(value, spe)
-			if err != nil {
-				fmt.Printf("Unmarshal Validation Parameter Policy err : %s\n", err)
-				return
-			}
-			value = []byte(spe.String())
-		}
-		msgMetadata = fmt.Sprintf("key: %s, value: %s", key, value)
-	}
-	fmt.Printf("Value\n\tvalue: %s\n\tversion: %s\n\tmetadata:\n\t\t%s\n", versionedValue.Value, versionedValue.Version.String(), msgMetadata)
+	msgMetadata := formatMetadata(metaResult)
+	fmt.Printf("Value\n\tvalue (%s): %s\n\tversion: %s\n\tmetadata:%s\n", contentType, realValue, versionedValue.Version.String(), msgMetadata)
 	fmt.Println()
 }
 
@@ -279,12 +272,33 @@ func (kv UserPublicKV) Value() string {
 	return string(versionedValue.Value)
 }
 
+// RenderedValue returns the value rendered by r, see ValueRenderer
+func (kv UserPublicKV) RenderedValue(r *ValueRenderer) string {
+	var versionedValue, _ = utils.DecodeValue(kv.value)
+	_, realValue := renderUserValue(r, kv.key, versionedValue.Value)
+	return realValue
+}
+
+// renderUserValue renders a user chaincode value with the overrides of its namespace in r
+func renderUserValue(r *ValueRenderer, key []byte, value []byte) (ContentType, string) {
+	ns := ""
+	if dk, err := splitDataKey(key); err == nil {
+		ns = dk.namespace
+	}
+	return r.Render(ns, value)
+}
+
 type UserPrivateKV struct {
 	key      []byte
 	value    []byte
 	describe string
 }
 
+// Decode returns the typed record of the entry
+func (kv UserPrivateKV) Decode() (*Record, error) {
+	return decodeDataRecord(kv.key, kv.value)
+}
+
 func (kv UserPrivateKV) Describe() string {
 	return kv.describe
 }
@@ -294,6 +308,11 @@ func (kv UserPrivateKV) Key() []byte {
 }
 
 func (kv UserPrivateKV) Print() {
+	kv.PrintWith(nil)
+}
+
+// PrintWith prints the entry with its private data value rendered by r, see ValueRenderer
+func (kv UserPrivateKV) PrintWith(r *ValueRenderer) {
 	var realValue string = ""
 	_, realKey, pvtPrefix := getDataNSKey(bytes.SplitN(kv.key, []byte{0x00}, 2)[1])
 	var versionedValue, err = utils.DecodeValue(kv.value)
@@ -303,7 +322,8 @@ func (kv UserPrivateKV) Print() {
 	}
 	switch pvtPrefix {
 	case byte('p'): // privateData
-		realValue = string(versionedValue.Value)
+		realKey = displayKey(realKey)
+		_, realValue = renderUserValue(r, kv.key, versionedValue.Value)
 	case byte('h'): // privateDataHash
 		realKey = hex.EncodeToString([]byte(realKey))
 		realValue = hex.EncodeToString(versionedValue.Value)
@@ -326,19 +346,7 @@ func (kv UserPrivateKV) Print() {
 		return
 	}
 
-	msgMetadata := ""
-	for key, value := range metaResult {
-		if key == "VALIDATION_PARAMETER" {
-			spe := &common.SignaturePolicyEnvelope{}
-			err := proto.Unmarshal(value, spe)
-			if err != nil {
-				fmt.Printf("Unmarshal Validation Parameter Policy err : %s\n", err)
-				return
-			}
-			value = []byte(spe.String())
-		}
-		msgMetadata = fmt.Sprintf("key: %s, value: %s", key, value)
-	}
+	msgMetadata := formatMetadata(metaResult)
 
 	fmt.Printf("Value\n\tvalue: %s\n\tversion: %s\n\tmetadata:%s\n", realValue, versionedValue.Version.String(), msgMetadata)
 }
@@ -348,6 +356,18 @@ func (kv UserPrivateKV) Type() int {
 }
 
 func (kv UserPrivateKV) Value() string {
+	return kv.decodeValue(func(value []byte) string { return string(value) })
+}
+
+// RenderedValue returns the value rendered by r, see ValueRenderer. Hashes are hex encoded as by Value.
+func (kv UserPrivateKV) RenderedValue(r *ValueRenderer) string {
+	return kv.decodeValue(func(value []byte) string {
+		_, realValue := renderUserValue(r, kv.key, value)
+		return realValue
+	})
+}
+
+func (kv UserPrivateKV) decodeValue(privateData func(value []byte) string) string {
 	var realValue string = ""
 	_, _, pvtPrefix := getDataNSKey(bytes.SplitN(kv.key, []byte{0x00}, 2)[1])
 	var versionedValue, err = utils.DecodeValue(kv.value)
@@ -356,7 +376,7 @@ func (kv UserPrivateKV) Value() string {
 	}
 	switch pvtPrefix {
 	case byte('p'): // privateData
-		realValue = string(versionedValue.Value)
+		realValue = privateData(versionedValue.Value)
 	case byte('h'): // privateDataHash
 		realValue = hex.EncodeToString(versionedValue.Value)
 	default: // publicData?
@@ -373,6 +393,11 @@ type FormatVersionKV struct {
 	describe string
 }
 
+// Decode returns the typed record of the entry
+func (kv FormatVersionKV) Decode() (*Record, error) {
+	return decodeChannelRecord(kv.key, kv.value), nil
+}
+
 func (kv FormatVersionKV) Describe() string {
 	return kv.describe
 }
@@ -406,6 +431,17 @@ type SavePointKV struct {
 	describe string
 }
 
+// Decode returns the typed record of the entry
+func (kv SavePointKV) Decode() (*Record, error) {
+	r := decodeChannelRecord(kv.key, kv.value)
+	h, _, err := version.NewHeightFromBytes(kv.value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the savepoint, error=[%v]", err)
+	}
+	r.Version = h
+	return r, nil
+}
+
 func (kv SavePointKV) Describe() string {
 	return kv.describe
 }
@@ -0,0 +1,333 @@
+package statediff
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/the-medium/ledger-parser/pkg/format"
+	"github.com/the-medium/ledger-parser/pkg/state"
+)
+
+// DiffKind is how the state of a key differs between the two dbs
+type DiffKind int
+
+const (
+	// OnlyInA: the key exists in the first db only
+	OnlyInA DiffKind = iota
+	// OnlyInB: the key exists in the second db only
+	OnlyInB
+	// ValueDiffers: the values differ, for hashed private data the value hashes
+	ValueDiffers
+	// VersionDiffers: the values are equal but were committed at different heights
+	VersionDiffers
+	// MetadataDiffers: values and versions are equal but the metadata differs
+	MetadataDiffers
+)
+
+var diffNames = map[DiffKind]string{
+	OnlyInA:         "ONLY_IN_A",
+	OnlyInB:         "ONLY_IN_B",
+	ValueDiffers:    "VALUE",
+	VersionDiffers:  "VERSION",
+	MetadataDiffers: "METADATA",
+}
+
+func (k DiffKind) String() string {
+	if name, ok := diffNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+// MarshalText encodes the kind by its name
+func (k DiffKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Diff is a key whose state differs between the two dbs
+type Diff struct {
+	Kind       DiffKind `json:"kind"`
+	Channel    string   `json:"channel"`
+	Namespace  string   `json:"namespace"`
+	Collection string   `json:"collection,omitempty"` // set for hashed private data, Key is then the hex encoded key hash
+	Key        string   `json:"key"`
+	Detail     string   `json:"detail"`
+}
+
+func (d Diff) String() string {
+	key := d.Key
+	if d.Collection != "" {
+		key = d.Collection + "/" + key
+	}
+	return fmt.Sprintf("[%s] %s/%s/%s: %s", d.Kind, d.Channel, d.Namespace, key, d.Detail)
+}
+
+// NamespaceStats counts the keys compared in a namespace of a channel
+type NamespaceStats struct {
+	Matched int `json:"matched"`
+	Differ  int `json:"differ"`
+}
+
+// Report is the result of comparing two stateLeveldbs
+type Report struct {
+	// SavePoints holds the savepoints of each channel in the first and second db, nil if absent.
+	// Dbs with different savepoints are expected to differ in the keys written in between.
+	SavePoints     map[string][2]*version.Height         `json:"savepoints"`
+	Matched        int                                   `json:"matched"`
+	SkippedPrivate int                                   `json:"skipped_private"` // cleartext private data only exists on member peers and is not compared
+	Namespaces     map[string]map[string]*NamespaceStats `json:"namespaces"`
+	Diffs          []Diff                                `json:"diffs"`
+}
+
+// OK reports whether the dbs hold the same state
+func (r *Report) OK() bool {
+	return len(r.Diffs) == 0
+}
+
+// JSON returns the report encoded as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary returns a plain-text summary of the report
+func (r *Report) Summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "matched: %d\n", r.Matched)
+	fmt.Fprintf(&sb, "differ: %d\n", len(r.Diffs))
+	fmt.Fprintf(&sb, "cleartext private data not compared: %d\n", r.SkippedPrivate)
+
+	for _, channel := range sortedKeys(r.Namespaces) {
+		fmt.Fprintf(&sb, "\n%s:\n", channel)
+		if savePoints, ok := r.SavePoints[channel]; ok {
+			fmt.Fprintf(&sb, "\tsavepoints: %s, %s\n", heightString(savePoints[0]), heightString(savePoints[1]))
+		}
+		namespaces := make([]string, 0, len(r.Namespaces[channel]))
+		for ns := range r.Namespaces[channel] {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+		for _, ns := range namespaces {
+			stats := r.Namespaces[channel][ns]
+			fmt.Fprintf(&sb, "\t%-32s matched: %8d  differ: %8d\n", ns, stats.Matched, stats.Differ)
+		}
+	}
+
+	if len(r.Diffs) > 0 {
+		sb.WriteString("\ndiffs:\n")
+		for _, d := range r.Diffs {
+			fmt.Fprintf(&sb, "\t%s\n", d)
+		}
+	}
+	return sb.String()
+}
+
+func sortedKeys(m map[string]map[string]*NamespaceStats) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func heightString(h *version.Height) string {
+	if h == nil {
+		return "none"
+	}
+	return h.String()
+}
+
+func (r *Report) stats(channel, ns string) *NamespaceStats {
+	if r.Namespaces[channel] == nil {
+		r.Namespaces[channel] = map[string]*NamespaceStats{}
+	}
+	if r.Namespaces[channel][ns] == nil {
+		r.Namespaces[channel][ns] = &NamespaceStats{}
+	}
+	return r.Namespaces[channel][ns]
+}
+
+// CompareDirs opens two stateLeveldb directories read-only and compares them
+func CompareDirs(pathA, pathB, channel string) (*Report, error) {
+	opts := opt.Options{ErrorIfMissing: true, ReadOnly: true}
+	a, err := leveldb.OpenFile(pathA, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot open state db: [%s], error=[%v]", pathA, err)
+	}
+	defer a.Close()
+	b, err := leveldb.OpenFile(pathB, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("error: cannot open state db: [%s], error=[%v]", pathB, err)
+	}
+	defer b.Close()
+	return Compare(a, b, channel)
+}
+
+// Compare walks two stateLeveldbs in key order and compares their public data and private
+// data hashes, of a single channel or of all channels if channel is empty. The dbs may be
+// written in different data formats.
+func Compare(a, b *leveldb.DB, channel string) (*Report, error) {
+	report := &Report{SavePoints: map[string][2]*version.Height{}, Namespaces: map[string]map[string]*NamespaceStats{}}
+	ca, err := newCursor(a, channel, report, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer ca.release()
+	cb, err := newCursor(b, channel, report, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer cb.release()
+
+	for ca.record != nil || cb.record != nil {
+		var c int
+		switch {
+		case ca.record == nil:
+			c = 1
+		case cb.record == nil:
+			c = -1
+		default:
+			c = bytes.Compare(ca.key, cb.key)
+		}
+		switch {
+		case c < 0:
+			report.add(ca.record, OnlyInA, fmt.Sprintf("version %s", ca.record.Version))
+			err = ca.next()
+		case c > 0:
+			report.add(cb.record, OnlyInB, fmt.Sprintf("version %s", cb.record.Version))
+			err = cb.next()
+		default:
+			report.compare(ca.record, cb.record)
+			if err = ca.next(); err == nil {
+				err = cb.next()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func (r *Report) add(record *state.Record, kind DiffKind, detail string) {
+	d := Diff{Kind: kind, Channel: record.Channel, Namespace: record.Namespace, Collection: record.Collection, Key: record.Key, Detail: detail}
+	if record.Hashed {
+		d.Key = hex.EncodeToString([]byte(record.Key))
+	}
+	r.Diffs = append(r.Diffs, d)
+	r.stats(record.Channel, record.Namespace).Differ++
+}
+
+func (r *Report) compare(a, b *state.Record) {
+	switch {
+	case !bytes.Equal(a.Value, b.Value):
+		r.add(a, ValueDiffers, fmt.Sprintf("version %s and %s", a.Version, b.Version))
+	case a.Version.Compare(b.Version) != 0:
+		r.add(a, VersionDiffers, fmt.Sprintf("version %s and %s", a.Version, b.Version))
+	case !equalMetadata(a.Metadata, b.Metadata):
+		r.add(a, MetadataDiffers, fmt.Sprintf("metadata entries %s and %s", metadataNames(a.Metadata), metadataNames(b.Metadata)))
+	default:
+		r.Matched++
+		r.stats(a.Channel, a.Namespace).Matched++
+	}
+}
+
+func equalMetadata(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func metadataNames(metadata map[string][]byte) []string {
+	names := []string{}
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cursor iterates over the comparable data entries of a db in the order of their 2.0 keys,
+// which a 1.x db shares since its data keys only lack the constant 'd' prefix
+type cursor struct {
+	iter    iterator.Iterator
+	format  format.Version
+	channel string
+	report  *Report
+	side    int
+
+	key    []byte
+	record *state.Record
+}
+
+func newCursor(db *leveldb.DB, channel string, report *Report, side int) (*cursor, error) {
+	f, err := format.Detect(db)
+	if err != nil {
+		return nil, err
+	}
+	var slice *lutil.Range
+	if channel != "" {
+		slice = lutil.BytesPrefix(append([]byte(channel), 0x00))
+	}
+	c := &cursor{iter: db.NewIterator(slice, nil), format: f, channel: channel, report: report, side: side}
+	if err := c.next(); err != nil {
+		c.release()
+		return nil, err
+	}
+	return c, nil
+}
+
+// next moves to the next data entry, recording savepoints and skipping cleartext private data
+func (c *cursor) next() error {
+	c.key, c.record = nil, nil
+	for c.iter.Next() {
+		if bytes.Equal(c.iter.Key(), format.FormatKey) {
+			continue
+		}
+		kv, err := state.ParseKVWithFormat(c.iter.Key(), c.iter.Value(), c.channel, c.format)
+		if err != nil {
+			return err
+		}
+		if kv == nil || kv.Type() == state.FormatVersion {
+			continue
+		}
+		record, err := kv.Decode()
+		if err != nil {
+			return err
+		}
+		if kv.Type() == state.SavePoint {
+			savePoints := c.report.SavePoints[record.Channel]
+			savePoints[c.side] = record.Version
+			c.report.SavePoints[record.Channel] = savePoints
+			continue
+		}
+		if record.Collection != "" && !record.Hashed {
+			if c.side == 0 {
+				c.report.SkippedPrivate++
+			}
+			continue
+		}
+		c.key, c.record = append([]byte{}, kv.Key()...), record
+		return nil
+	}
+	return c.iter.Error()
+}
+
+func (c *cursor) release() {
+	c.iter.Release()
+}
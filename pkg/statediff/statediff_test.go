@@ -0,0 +1,95 @@
+package statediff
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/statedb"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/the-medium/ledger-parser/internal/utils"
+	"github.com/the-medium/ledger-parser/pkg/format"
+)
+
+func put(t *testing.T, db *leveldb.DB, key, value string, blockNum uint64, metadata []byte) {
+	v, err := utils.EncodeValue(&statedb.VersionedValue{Value: []byte(value), Metadata: metadata, Version: version.NewHeight(blockNum, 0)})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte(key), v, nil))
+}
+
+func openDB(t *testing.T, dir, name string) *leveldb.DB {
+	db, err := leveldb.OpenFile(filepath.Join(dir, name), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put(format.FormatKey, []byte("2.0"), nil))
+	assert.NoError(t, db.Put([]byte("mychannel\x00s"), version.NewHeight(9, 0).ToBytes(), nil))
+	return db
+}
+
+func TestCompare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statediff")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a, b := openDB(t, dir, "a"), openDB(t, dir, "b")
+	defer a.Close()
+	defer b.Close()
+
+	hash := string([]byte{0xab, 0x00, 0xcd})
+	for _, db := range []*leveldb.DB{a, b} {
+		put(t, db, "mychannel\x00dmycc\x00same", "v", 3, nil)
+		put(t, db, "mychannel\x00dmycc$$hcoll1\x00"+hash, "valuehash", 4, nil)
+	}
+	put(t, a, "mychannel\x00dmycc\x00onlyA", "v", 3, nil)
+	put(t, b, "mychannel\x00dmycc\x00onlyB", "v", 3, nil)
+	put(t, a, "mychannel\x00dmycc\x00value", "1", 3, nil)
+	put(t, b, "mychannel\x00dmycc\x00value", "2", 3, nil)
+	put(t, a, "mychannel\x00dmycc\x00version", "v", 3, nil)
+	put(t, b, "mychannel\x00dmycc\x00version", "v", 4, nil)
+	put(t, a, "mychannel\x00dother\x00metadata", "v", 3, nil)
+	metadata, err := utils.Serialize([]*kvrwset.KVMetadataEntry{{Name: "VALIDATION_PARAMETER", Value: []byte("policy")}})
+	assert.NoError(t, err)
+	put(t, b, "mychannel\x00dother\x00metadata", "v", 3, metadata)
+	// cleartext private data exists on member peers only
+	put(t, a, "mychannel\x00dmycc$$pcoll1\x00secret", "s", 4, nil)
+	put(t, a, "mychannel\x00dmycc$$pcoll1\x00secret2", "s", 4, nil)
+
+	report, err := Compare(a, b, "")
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 2, report.Matched)
+	assert.Equal(t, 2, report.SkippedPrivate)
+	assert.Equal(t, [2]*version.Height{version.NewHeight(9, 0), version.NewHeight(9, 0)}, report.SavePoints["mychannel"])
+	assert.Equal(t, &NamespaceStats{Matched: 2, Differ: 4}, report.Namespaces["mychannel"]["mycc"])
+	assert.Equal(t, &NamespaceStats{Differ: 1}, report.Namespaces["mychannel"]["other"])
+
+	kinds := map[string]DiffKind{}
+	for _, d := range report.Diffs {
+		kinds[d.Key] = d.Kind
+	}
+	assert.Equal(t, map[string]DiffKind{
+		"onlyA":    OnlyInA,
+		"onlyB":    OnlyInB,
+		"value":    ValueDiffers,
+		"version":  VersionDiffers,
+		"metadata": MetadataDiffers,
+	}, kinds)
+
+	put(t, b, "mychannel\x00dmycc$$hcoll1\x00"+hash, "otherhash", 4, nil)
+	report, err = Compare(a, b, "mychannel")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Matched)
+	assert.Contains(t, report.Diffs, Diff{Kind: ValueDiffers, Channel: "mychannel", Namespace: "mycc", Collection: "coll1", Key: hex.EncodeToString([]byte(hash)), Detail: fmt.Sprintf("version %s and %s", version.NewHeight(4, 0), version.NewHeight(4, 0))})
+	assert.Contains(t, report.Summary(), "[VALUE] mychannel/mycc/coll1/ab00cd")
+	j, err := report.JSON()
+	assert.NoError(t, err)
+	assert.Contains(t, string(j), `"kind": "ONLY_IN_A"`)
+
+	report, err = Compare(a, b, "otherchannel")
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+}
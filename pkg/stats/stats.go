@@ -0,0 +1,336 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/the-medium/ledger-parser/pkg/block"
+)
+
+const dayLayout = "2006-01-02"
+
+// Collector accumulates statistics over a stream of blocks
+type Collector struct {
+	report     *Report
+	blockSizes []int
+	txCounts   []int
+}
+
+// NewCollector returns an empty Collector
+func NewCollector() *Collector {
+	return &Collector{
+		report: &Report{
+			PerDay:            map[string]*DayStats{},
+			ValidationCodes:   map[string]uint64{},
+			TxTypes:           map[string]uint64{},
+			Chaincodes:        map[string]*ChaincodeStats{},
+			Creators:          map[string]uint64{},
+			NamespacesRead:    map[string]uint64{},
+			NamespacesWritten: map[string]uint64{},
+		},
+	}
+}
+
+// FromChainDir collects statistics over every block of a channel directory
+func FromChainDir(chainDir string) (*Report, error) {
+	c := NewCollector()
+	err := block.WalkBlocks(chainDir, func(b block.Block) error {
+		return c.AddBlock(b.GetBlock())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Report(), nil
+}
+
+// AddBlock adds a single block to the statistics. A transaction that does not decode, e.g. a
+// BAD_PAYLOAD one the peer never decoded either, is counted under its validation code and as
+// undecodable rather than failing the block.
+func (c *Collector) AddBlock(b *common.Block) error {
+	r := c.report
+	num := b.GetHeader().GetNumber()
+	if r.Blocks == 0 || num < r.FirstBlock {
+		r.FirstBlock = num
+	}
+	if r.Blocks == 0 || num > r.LastBlock {
+		r.LastBlock = num
+	}
+	numTxs := len(b.GetData().GetData())
+	r.Blocks++
+	r.Transactions += uint64(numTxs)
+	c.blockSizes = append(c.blockSizes, proto.Size(b))
+	c.txCounts = append(c.txCounts, numTxs)
+
+	day := ""
+	for txNum := 0; txNum < numTxs; txNum++ {
+		tx := c.addTransaction(b, txNum)
+		if tx == nil {
+			continue
+		}
+		if r.Channel == "" {
+			r.Channel = tx.ChannelID
+		}
+		if day == "" && !tx.Timestamp.IsZero() {
+			day = tx.Timestamp.UTC().Format(dayLayout)
+		}
+	}
+
+	if day == "" {
+		day = "unknown"
+	}
+	ds, ok := r.PerDay[day]
+	if !ok {
+		ds = &DayStats{}
+		r.PerDay[day] = ds
+	}
+	ds.Blocks++
+	ds.Transactions += uint64(numTxs)
+	return nil
+}
+
+// addTransaction counts the transaction at txNum and returns its headers, nil if they do not decode.
+// Only endorser transactions are decoded beyond their headers.
+func (c *Collector) addTransaction(b *common.Block, txNum int) *block.Transaction {
+	r := c.report
+	code := block.GetValidationCode(b, txNum)
+	r.ValidationCodes[code.String()]++
+	tx, err := block.GetTransactionHeader(b, txNum)
+	if err != nil {
+		r.Undecodable++
+		return nil
+	}
+	r.TxTypes[tx.Type.String()]++
+	if tx.CreatorMSPID != "" {
+		r.Creators[tx.CreatorMSPID]++
+	}
+	if tx.Type != common.HeaderType_ENDORSER_TRANSACTION {
+		return tx
+	}
+	full, err := block.GetTransaction(b, txNum)
+	if err != nil {
+		r.Undecodable++
+		return tx
+	}
+
+	cs, ok := r.Chaincodes[full.Chaincode]
+	if !ok {
+		cs = &ChaincodeStats{Functions: map[string]uint64{}}
+		r.Chaincodes[full.Chaincode] = cs
+	}
+	cs.Invocations++
+	if full.IsValid() {
+		cs.Valid++
+	}
+	cs.Functions[full.Function]++
+
+	// only valid transactions have their reads and writes applied to the ledger
+	if full.RWSet == nil || !full.IsValid() {
+		return tx
+	}
+	for _, nsRWSet := range full.RWSet.NsRwSets {
+		kvRWSet := nsRWSet.KvRwSet
+		if kvRWSet == nil {
+			continue
+		}
+		if len(kvRWSet.Reads) != 0 || len(kvRWSet.RangeQueriesInfo) != 0 {
+			r.NamespacesRead[nsRWSet.NameSpace]++
+		}
+		if len(kvRWSet.Writes) != 0 || len(kvRWSet.MetadataWrites) != 0 {
+			r.NamespacesWritten[nsRWSet.NameSpace]++
+		}
+	}
+	return tx
+}
+
+// Report returns the statistics collected so far
+func (c *Collector) Report() *Report {
+	r := *c.report
+	r.BlockSize = newDistribution(c.blockSizes)
+	r.TxPerBlock = newDistribution(c.txCounts)
+	return &r
+}
+
+// Report is the result of a statistics run over a block stream
+type Report struct {
+	Channel           string                     `json:"channel"`
+	FirstBlock        uint64                     `json:"first_block"`
+	LastBlock         uint64                     `json:"last_block"`
+	Blocks            uint64                     `json:"blocks"`
+	Transactions      uint64                     `json:"transactions"`
+	Undecodable       uint64                     `json:"undecodable"` // transactions that do not fully decode
+	PerDay            map[string]*DayStats       `json:"per_day"`
+	BlockSize         Distribution               `json:"block_size"`
+	TxPerBlock        Distribution               `json:"tx_per_block"`
+	ValidationCodes   map[string]uint64          `json:"validation_codes"`
+	TxTypes           map[string]uint64          `json:"tx_types"`
+	Chaincodes        map[string]*ChaincodeStats `json:"chaincodes"`
+	Creators          map[string]uint64          `json:"creators"`
+	NamespacesRead    map[string]uint64          `json:"namespaces_read"`
+	NamespacesWritten map[string]uint64          `json:"namespaces_written"`
+}
+
+// DayStats counts blocks and transactions of a single UTC day
+type DayStats struct {
+	Blocks       uint64 `json:"blocks"`
+	Transactions uint64 `json:"transactions"`
+}
+
+// ChaincodeStats counts the invocations of a chaincode, broken down by function
+type ChaincodeStats struct {
+	Invocations uint64            `json:"invocations"`
+	Valid       uint64            `json:"valid"`
+	Functions   map[string]uint64 `json:"functions"`
+}
+
+// Distribution summarizes a series of samples
+type Distribution struct {
+	Count     int      `json:"count"`
+	Min       int      `json:"min"`
+	Max       int      `json:"max"`
+	Mean      float64  `json:"mean"`
+	P50       int      `json:"p50"`
+	P90       int      `json:"p90"`
+	P99       int      `json:"p99"`
+	Histogram []Bucket `json:"histogram"`
+}
+
+// Bucket counts the samples that are less than or equal to UpperBound
+// and greater than the UpperBound of the previous bucket.
+type Bucket struct {
+	UpperBound int `json:"upper_bound"`
+	Count      int `json:"count"`
+}
+
+func newDistribution(samples []int) Distribution {
+	d := Distribution{Count: len(samples)}
+	if len(samples) == 0 {
+		return d
+	}
+	sorted := append([]int(nil), samples...)
+	sort.Ints(sorted)
+
+	sum := 0
+	for _, s := range sorted {
+		sum += s
+	}
+	d.Min = sorted[0]
+	d.Max = sorted[len(sorted)-1]
+	d.Mean = float64(sum) / float64(len(sorted))
+	d.P50 = percentile(sorted, 50)
+	d.P90 = percentile(sorted, 90)
+	d.P99 = percentile(sorted, 99)
+
+	// power of two buckets
+	upper := 1
+	i := 0
+	for i < len(sorted) {
+		count := 0
+		for i < len(sorted) && sorted[i] <= upper {
+			count++
+			i++
+		}
+		if count != 0 {
+			d.Histogram = append(d.Histogram, Bucket{UpperBound: upper, Count: count})
+		}
+		upper *= 2
+	}
+	return d
+}
+
+// percentile uses the nearest-rank method on sorted samples
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// JSON returns the report encoded as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary returns a plain-text summary of the report
+func (r *Report) Summary() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "channel: %s\n", r.Channel)
+	fmt.Fprintf(&sb, "blocks: %d (%d - %d)\n", r.Blocks, r.FirstBlock, r.LastBlock)
+	fmt.Fprintf(&sb, "transactions: %d\n", r.Transactions)
+	fmt.Fprintf(&sb, "undecodable: %d\n", r.Undecodable)
+
+	sb.WriteString("\nper day:\n")
+	for _, day := range sortedKeys(r.PerDay) {
+		ds := r.PerDay[day]
+		fmt.Fprintf(&sb, "\t%s  blocks: %8d  transactions: %8d\n", day, ds.Blocks, ds.Transactions)
+	}
+
+	sb.WriteString("\nblock size (bytes):\n")
+	writeDistribution(&sb, r.BlockSize)
+	sb.WriteString("\ntransactions per block:\n")
+	writeDistribution(&sb, r.TxPerBlock)
+
+	sb.WriteString("\nvalidation codes:\n")
+	writeCounts(&sb, r.ValidationCodes)
+	sb.WriteString("\ntransaction types:\n")
+	writeCounts(&sb, r.TxTypes)
+
+	sb.WriteString("\nchaincodes:\n")
+	for _, name := range sortedKeys(r.Chaincodes) {
+		cs := r.Chaincodes[name]
+		fmt.Fprintf(&sb, "\t%s  invocations: %d  valid: %d\n", name, cs.Invocations, cs.Valid)
+		for _, fn := range sortedKeys(cs.Functions) {
+			fmt.Fprintf(&sb, "\t\t%-32s %d\n", fn, cs.Functions[fn])
+		}
+	}
+
+	sb.WriteString("\ncreators:\n")
+	writeCounts(&sb, r.Creators)
+	sb.WriteString("\nnamespaces read:\n")
+	writeCounts(&sb, r.NamespacesRead)
+	sb.WriteString("\nnamespaces written:\n")
+	writeCounts(&sb, r.NamespacesWritten)
+
+	return sb.String()
+}
+
+func writeDistribution(sb *strings.Builder, d Distribution) {
+	fmt.Fprintf(sb, "\tcount: %d  min: %d  max: %d  mean: %.1f  p50: %d  p90: %d  p99: %d\n",
+		d.Count, d.Min, d.Max, d.Mean, d.P50, d.P90, d.P99)
+	for _, b := range d.Histogram {
+		fmt.Fprintf(sb, "\t\t<= %-10d %d\n", b.UpperBound, b.Count)
+	}
+}
+
+func writeCounts(sb *strings.Builder, counts map[string]uint64) {
+	for _, k := range sortedKeys(counts) {
+		fmt.Fprintf(sb, "\t%-40s %d\n", k, counts[k])
+	}
+}
+
+// sortedKeys returns the keys of a string keyed map in ascending order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]uint64:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*DayStats:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*ChaincodeStats:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/the-medium/ledger-parser/internal/testutil"
+	"github.com/the-medium/ledger-parser/pkg/block"
+)
+
+func invoke(txID, msp, fn string, day time.Time, code peer.TxValidationCode) *testutil.Tx {
+	return &testutil.Tx{
+		TxID:      txID,
+		ChannelID: "mychannel",
+		Type:      common.HeaderType_ENDORSER_TRANSACTION,
+		Timestamp: day,
+		MSPID:     msp,
+		Chaincode: "mycc",
+		Args:      [][]byte{[]byte(fn), []byte("a")},
+		RWSet: &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{
+			{NameSpace: "mycc", KvRwSet: &kvrwset.KVRWSet{
+				Reads:  []*kvrwset.KVRead{{Key: "a"}},
+				Writes: []*kvrwset.KVWrite{{Key: "a", Value: []byte("1")}},
+			}},
+			{NameSpace: "other", KvRwSet: &kvrwset.KVRWSet{
+				Reads: []*kvrwset.KVRead{{Key: "b"}},
+			}},
+		}},
+		ValidationCode: code,
+	}
+}
+
+func TestCollector(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	blocks, err := testutil.NewChain(true,
+		[]*testutil.Tx{
+			{TxID: "config", ChannelID: "mychannel", Type: common.HeaderType_CONFIG, Timestamp: day1, MSPID: "OrdererMSP"},
+		},
+		[]*testutil.Tx{
+			invoke("tx1", "Org1MSP", "put", day1, peer.TxValidationCode_VALID),
+			invoke("tx2", "Org2MSP", "put", day1, peer.TxValidationCode_MVCC_READ_CONFLICT),
+		},
+		[]*testutil.Tx{
+			invoke("tx3", "Org1MSP", "get", day2, peer.TxValidationCode_VALID),
+			{TxID: "bad", ValidationCode: peer.TxValidationCode_BAD_PAYLOAD, Malformed: true},
+		},
+	)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "stats")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, testutil.WriteBlockFile(filepath.Join(dir, "blockfile_000000"), blocks...))
+
+	r, err := FromChainDir(dir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "mychannel", r.Channel)
+	assert.Equal(t, uint64(3), r.Blocks)
+	assert.Equal(t, uint64(5), r.Transactions)
+	assert.Equal(t, uint64(1), r.Undecodable)
+	assert.Equal(t, uint64(2), r.LastBlock)
+	assert.Equal(t, &DayStats{Blocks: 2, Transactions: 3}, r.PerDay["2026-03-01"])
+	assert.Equal(t, &DayStats{Blocks: 1, Transactions: 2}, r.PerDay["2026-03-02"])
+	assert.Equal(t, uint64(3), r.ValidationCodes["VALID"])
+	assert.Equal(t, uint64(1), r.ValidationCodes["MVCC_READ_CONFLICT"])
+	assert.Equal(t, uint64(1), r.ValidationCodes["BAD_PAYLOAD"])
+	assert.Equal(t, uint64(3), r.Chaincodes["mycc"].Invocations)
+	assert.Equal(t, uint64(2), r.Chaincodes["mycc"].Valid)
+	assert.Equal(t, uint64(2), r.Chaincodes["mycc"].Functions["put"])
+	assert.Equal(t, uint64(2), r.Creators["Org1MSP"])
+	assert.Equal(t, uint64(1), r.Creators["OrdererMSP"])
+	assert.Equal(t, uint64(2), r.NamespacesWritten["mycc"])
+	assert.Equal(t, uint64(2), r.NamespacesRead["other"])
+	assert.Zero(t, r.NamespacesWritten["other"])
+	assert.Equal(t, 3, r.TxPerBlock.Count)
+	assert.Equal(t, 2, r.TxPerBlock.Max)
+
+	b, err := r.JSON()
+	assert.NoError(t, err)
+	decoded := &Report{}
+	assert.NoError(t, json.Unmarshal(b, decoded))
+	assert.Equal(t, r.Transactions, decoded.Transactions)
+
+	assert.Contains(t, r.Summary(), "2026-03-02")
+}
+
+func TestTransactionsWithoutFilter(t *testing.T) {
+	b, err := testutil.NewBlock(0, nil, false, invoke("tx1", "Org1MSP", "put", time.Now(), peer.TxValidationCode_VALID))
+	assert.NoError(t, err)
+	txs, err := block.GetTransactions(b)
+	assert.NoError(t, err)
+	assert.Equal(t, peer.TxValidationCode_NOT_VALIDATED, txs[0].ValidationCode)
+}